@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kotei/internal/canon"
+	"kotei/internal/config"
+	"kotei/internal/logging"
+	"kotei/internal/notify"
+	"kotei/internal/processor"
+	"kotei/internal/scheduler"
+	"kotei/internal/server"
+	"kotei/internal/sonarr"
+	"kotei/internal/state"
+	"kotei/internal/util"
+)
+
+// version is overridden at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+const (
+	exitOK          = 0
+	exitRunErrors   = 1
+	exitUsage       = 2
+	exitConfigError = 3
+)
+
+const usageText = `Usage: kotei <command> [flags]
+
+Commands:
+  run        Sync canon episodes to Sonarr (default), once or on schedule.cron_spec
+  plan       Show the changes a run would make without applying them
+  apply      Execute a plan file saved with 'kotei plan --out'
+  validate   Check the config file and exit
+  list       List the configured anime entries
+  explain    Show a detailed plan for a single anime entry
+  history    Show recorded runs, or the outcomes of one anime entry
+  rollback   Restore the monitored flags a recorded run changed
+  version    Print the Kotei version
+
+Run 'kotei <command> -h' for the flags of a command.
+`
+
+type commonFlags struct {
+	configPath string
+	dryRun     bool
+	only       string
+}
+
+func newFlagSet(name string, common *commonFlags, withRunFlags bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&common.configPath, "config", config.DefaultPath(), "path to the config file (env "+config.ConfigPathEnv+")")
+	if withRunFlags {
+		fs.BoolVar(&common.dryRun, "dry-run", false, "simulate changes without touching Sonarr (in addition to dry_run in the config)")
+		fs.StringVar(&common.only, "only", "", "only process the anime entry with this title or sonarr_title")
+	}
+	return fs
+}
+
+// parseExitCode is the exit code for a flag parsing error: -h and --help
+// print the flags and succeed.
+func parseExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+func runCLI(ctx context.Context, args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runRunCommand(ctx, args)
+	}
+	switch args[0] {
+	case "run":
+		return runRunCommand(ctx, args[1:])
+	case "plan":
+		return runPlanCommand(ctx, args[1:])
+	case "apply":
+		return runApplyCommand(ctx, args[1:])
+	case "validate":
+		return runValidateCommand(args[1:])
+	case "list":
+		return runListCommand(args[1:])
+	case "explain":
+		return runExplainCommand(ctx, args[1:])
+	case "history":
+		return runHistoryCommand(args[1:])
+	case "rollback":
+		return runRollbackCommand(ctx, args[1:])
+	case "version":
+		fmt.Printf("kotei %s\n", version)
+		return exitOK
+	case "help", "-h", "--help":
+		fmt.Print(usageText)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command '%s'.\n\n%s", args[0], usageText)
+	return exitUsage
+}
+
+// validateConfig collects the problems found by every package that checks
+// part of the config.
+func validateConfig(appConfig config.Config) config.ValidationErrors {
+	errs := processor.ValidateConfig(appConfig)
+	return append(errs, notify.Validate(appConfig)...)
+}
+
+func loadConfig(common commonFlags) (config.Config, int) {
+	appConfig, err := config.LoadConfig(common.configPath)
+	if err != nil {
+		log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+		return appConfig, exitConfigError
+	}
+	if errs := validateConfig(appConfig); len(errs) > 0 {
+		log.Printf("%s %s has %d problem(s):", util.RedBold("!!! ERROR"), common.configPath, len(errs))
+		for _, e := range errs {
+			log.Printf("  - %s", e.Error())
+		}
+		return appConfig, exitConfigError
+	}
+	logger, err := logging.New(os.Stderr, logging.Options{Format: appConfig.Log.Format, Level: appConfig.Log.Level})
+	if err != nil {
+		log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+		return appConfig, exitConfigError
+	}
+	// Also routes the standard log package through the configured handler.
+	slog.SetDefault(logger)
+
+	if common.dryRun {
+		appConfig.DryRun = true
+	}
+	if common.only != "" {
+		if appConfig.Animes, err = config.FilterAnimes(appConfig.Animes, common.only); err != nil {
+			log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+			return appConfig, exitUsage
+		}
+	}
+	return appConfig, exitOK
+}
+
+func runRunCommand(ctx context.Context, args []string) int {
+	var common commonFlags
+	fs := newFlagSet("run", &common, true)
+	once := fs.Bool("once", false, "run a single pass and exit, ignoring schedule.cron_spec")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+
+	appConfig, code := loadConfig(common)
+	if code != exitOK {
+		return code
+	}
+	if *once {
+		appConfig.Schedule.CronSpec = ""
+	}
+
+	logger := slog.Default()
+	logger.Info("--- Anime Canon Episode Monitor (Kotei) ---", "version", version)
+	if appConfig.DryRun {
+		logger.Warn("*** DRY RUN MODE ENABLED ***")
+	}
+
+	canon.Configure(appConfig, logger)
+	sClient := sonarr.NewClient(appConfig, logger)
+
+	sched := scheduler.New(ctx, logger, appConfig, sClient, appConfig.DryRun)
+	notifier, err := notify.New(appConfig, logger)
+	if err != nil {
+		logger.Error("Failed to set up notifications", "error", err)
+		return exitConfigError
+	}
+	sched.SetNotifier(notifier)
+	if store := openState(appConfig, logger); store != nil {
+		sched.SetRecorder(store)
+		notifier.SetDigestStore(store)
+	}
+	if targets := notifier.Targets(); targets > 0 {
+		logger.Info("Notifications enabled", "targets", targets)
+	}
+	var httpServer *server.Server
+	if appConfig.Server.Enabled {
+		if appConfig.Schedule.CronSpec == "" {
+			logger.Info("HTTP server not started in single run mode")
+		} else {
+			httpServer = server.New(appConfig.Server.Listen, appConfig.Server.Token, sched, logger)
+			if err := httpServer.Start(); err != nil {
+				logger.Error("Failed to start HTTP server", "error", err)
+				return exitConfigError
+			}
+		}
+	}
+
+	if appConfig.Schedule.CronSpec != "" {
+		watchConfig(common, sched, notifier, logger)
+	}
+
+	errorCount, err := sched.Run()
+	if httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("HTTP server did not shut down cleanly", "error", err)
+		}
+	}
+	if err != nil {
+		logger.Error("Scheduler failed", "error", err)
+		return exitConfigError
+	}
+	if errorCount > 0 {
+		return exitRunErrors
+	}
+	return exitOK
+}
+
+// watchConfig reloads the scheduler whenever the config file changes. A
+// config that fails to load or validate is reported and the current one kept.
+func watchConfig(common commonFlags, sched *scheduler.Scheduler, notifier *notify.Dispatcher, logger *slog.Logger) {
+	configLogger := logger.With(logging.ComponentKey, "config")
+	err := config.Watch(common.configPath, configLogger, func() {
+		configLogger.Info("Config file changed, reloading", "path", common.configPath)
+		newConfig, err := config.LoadConfig(common.configPath)
+		if err != nil {
+			configLogger.Error("Config reload failed, keeping the current config", "error", err)
+			return
+		}
+		if errs := validateConfig(newConfig); len(errs) > 0 {
+			configLogger.Error("Config reload failed, keeping the current config", "problems", len(errs))
+			for _, e := range errs {
+				configLogger.Error("  - " + e.Error())
+			}
+			return
+		}
+		if common.dryRun {
+			newConfig.DryRun = true
+		}
+		if common.only != "" {
+			if newConfig.Animes, err = config.FilterAnimes(newConfig.Animes, common.only); err != nil {
+				configLogger.Error("Config reload failed, keeping the current config", "error", err)
+				return
+			}
+		}
+		if err := sched.Reload(newConfig); err != nil {
+			configLogger.Error("Config reload failed, keeping the current config", "error", err)
+			return
+		}
+		if changed, err := notifier.Configure(newConfig); err != nil {
+			configLogger.Error("Notification settings not reloaded", "error", err)
+		} else if changed {
+			configLogger.Info("Notification settings reloaded", "targets", notifier.Targets())
+		}
+	})
+	if err != nil {
+		configLogger.Error("Cannot watch the config file, changes need a restart", "path", common.configPath, "error", err)
+	}
+}
+
+// openState opens the state store for recording runs. A store that cannot be
+// opened is reported and runs go unrecorded rather than not happening.
+func openState(appConfig config.Config, logger *slog.Logger) *state.Store {
+	if !appConfig.State.Enabled {
+		return nil
+	}
+	store, err := state.Open(appConfig.State.DataDir)
+	if err != nil {
+		logger.Warn("State store unavailable, runs will not be recorded", "error", err)
+		return nil
+	}
+	logger.Debug("Recording runs", "path", store.Path())
+	return store
+}
+
+func buildPlans(ctx context.Context, appConfig config.Config) (processor.PlanFile, int, error) {
+	logger := slog.Default()
+	canon.Configure(appConfig, logger)
+	sClient := sonarr.NewClient(appConfig, logger)
+
+	planFile := processor.PlanFile{CreatedAt: time.Now(), DryRun: appConfig.DryRun}
+	seriesIndex, err := sClient.FetchSeriesIndex(ctx)
+	if err != nil {
+		return planFile, 0, fmt.Errorf("could not load Sonarr series list: %w", err)
+	}
+
+	failures := 0
+	for _, animeCfg := range appConfig.Animes {
+		plan, err := processor.PlanAnime(ctx, logger, animeCfg, sClient, seriesIndex)
+		if err != nil {
+			failures++
+		}
+		if plan != nil {
+			planFile.Plans = append(planFile.Plans, plan)
+		}
+	}
+	return planFile, failures, nil
+}
+
+func runPlanCommand(ctx context.Context, args []string) int {
+	var common commonFlags
+	fs := newFlagSet("plan", &common, false)
+	fs.StringVar(&common.only, "only", "", "only plan the anime entry with this title or sonarr_title")
+	format := fs.String("format", "table", "output format: table or json")
+	outPath := fs.String("out", "", "also save the plan to this file for 'kotei apply'")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if *format != "table" && *format != "json" {
+		log.Printf("%s Unknown --format '%s' (expected table or json).", util.RedBold("!!! ERROR"), *format)
+		return exitUsage
+	}
+
+	appConfig, code := loadConfig(common)
+	if code != exitOK {
+		return code
+	}
+	planFile, failures, err := buildPlans(ctx, appConfig)
+	if err != nil {
+		log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+		return exitRunErrors
+	}
+
+	if *format == "json" {
+		err = processor.WritePlanJSON(os.Stdout, planFile)
+	} else {
+		err = processor.WritePlanTable(os.Stdout, planFile.Plans)
+	}
+	if err != nil {
+		log.Printf("%s Failed to write plan: %v", util.RedBold("!!! ERROR"), err)
+		return exitRunErrors
+	}
+
+	if *outPath != "" {
+		if err := processor.SavePlanFile(*outPath, planFile); err != nil {
+			log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+			return exitRunErrors
+		}
+		slog.Info("Plan saved", "path", *outPath)
+	}
+	if failures > 0 {
+		return exitRunErrors
+	}
+	return exitOK
+}
+
+func runApplyCommand(ctx context.Context, args []string) int {
+	var common commonFlags
+	fs := newFlagSet("apply", &common, false)
+	fs.BoolVar(&common.dryRun, "dry-run", false, "show what would be applied without changing Sonarr")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: kotei apply [--config path] [--dry-run] <plan-file>")
+		return exitUsage
+	}
+
+	planFile, err := processor.LoadPlanFile(fs.Arg(0))
+	if err != nil {
+		log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+		return exitUsage
+	}
+	appConfig, code := loadConfig(common)
+	if code != exitOK {
+		return code
+	}
+	logger := slog.Default()
+	sClient := sonarr.NewClient(appConfig, logger)
+
+	logger.Info("Applying plan", "path", fs.Arg(0), "created", planFile.CreatedAt.Format("2006-01-02 15:04:05"))
+	stats := scheduler.RunStats{
+		ID:        scheduler.NewRunID(),
+		Trigger:   scheduler.TriggerApply,
+		StartedAt: time.Now(),
+		DryRun:    appConfig.DryRun,
+		Animes:    []scheduler.AnimeResult{},
+	}
+	for _, plan := range planFile.Plans {
+		outcome, err := processor.ApplyPlan(ctx, logger, plan, sClient, appConfig.DryRun)
+		stats.Processed++
+		result := scheduler.AnimeResult{
+			Anime:       plan.Anime,
+			Status:      scheduler.AnimeStatusOK,
+			ActionTaken: outcome.ActionTaken,
+			FinishedAt:  time.Now(),
+			SeriesID:    outcome.SeriesID,
+			SeriesTitle: outcome.SeriesTitle,
+			SeriesSlug:  outcome.SeriesSlug,
+			Monitored:   outcome.Monitored,
+			Unmonitored: outcome.Unmonitored,
+			Searched:    outcome.Searched,
+		}
+		if err != nil {
+			stats.Errors++
+			stats.Failed++
+			result.Status, result.Error = scheduler.AnimeStatusError, err.Error()
+		} else {
+			stats.OK++
+		}
+		stats.Animes = append(stats.Animes, result)
+	}
+	stats.FinishedAt = time.Now()
+	if store := openState(appConfig, logger); store != nil {
+		if err := store.RecordRun(stats); err != nil {
+			logger.Warn("Failed to record run in the state store", "run_id", stats.ID, "error", err)
+		}
+	}
+	failures := stats.Failed
+	if appConfig.DryRun {
+		logging.Heading(logger, "(Dry Run - No changes made)")
+	}
+	if failures > 0 {
+		logger.Error("Apply completed with errors.", "failed", failures)
+		return exitRunErrors
+	}
+	logger.Info("Apply completed successfully.")
+	return exitOK
+}
+
+func runValidateCommand(args []string) int {
+	var common commonFlags
+	fs := newFlagSet("validate", &common, false)
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	appConfig, code := loadConfig(common)
+	if code != exitOK {
+		return code
+	}
+	log.Printf("%s %s is valid (%d anime entries).", util.GreenBold("[OK]"), common.configPath, len(appConfig.Animes))
+	return exitOK
+}
+
+func runListCommand(args []string) int {
+	var common commonFlags
+	fs := newFlagSet("list", &common, false)
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	appConfig, code := loadConfig(common)
+	if code != exitOK {
+		return code
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ANIME\tSONARR\tSOURCE\tTYPES\tCUTOFF\tSYNC\tSEARCH\tSCHEDULE")
+	for _, animeCfg := range appConfig.Animes {
+		sonarrKey := animeCfg.SonarrTitle
+		if animeCfg.SonarrID != 0 {
+			sonarrKey = fmt.Sprintf("sonarr_id %d", animeCfg.SonarrID)
+		} else if animeCfg.TvdbID != 0 {
+			sonarrKey = fmt.Sprintf("tvdb_id %d", animeCfg.TvdbID)
+		}
+		source := animeCfg.Source
+		if source == "" {
+			source = canon.DefaultSourceName
+		}
+		syncMode := config.SyncModeMonitor
+		if animeCfg.IsStrict() {
+			syncMode = config.SyncModeStrict
+		}
+		var types []string
+		for _, t := range canon.ParseTypes(animeCfg.IncludeCanonTypes) {
+			types = append(types, string(t))
+		}
+		schedule := animeCfg.CronSpec(appConfig.Schedule.CronSpec)
+		if schedule == "" {
+			schedule = "once"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%t\t%s\n",
+			animeCfg.FillerListTitle, sonarrKey, source, strings.Join(types, ","), animeCfg.CutoffEpisode, syncMode, animeCfg.SearchEnabled, schedule)
+	}
+	if err := tw.Flush(); err != nil {
+		return exitRunErrors
+	}
+	return exitOK
+}
+
+func runExplainCommand(ctx context.Context, args []string) int {
+	var common commonFlags
+	fs := newFlagSet("explain", &common, false)
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: kotei explain [--config path] <title>")
+		return exitUsage
+	}
+	common.only = fs.Arg(0)
+
+	appConfig, code := loadConfig(common)
+	if code != exitOK {
+		return code
+	}
+	planFile, failures, err := buildPlans(ctx, appConfig)
+	if err != nil {
+		log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+		return exitRunErrors
+	}
+	if err := processor.WritePlanTable(os.Stdout, planFile.Plans); err != nil {
+		return exitRunErrors
+	}
+	for _, plan := range planFile.Plans {
+		if len(plan.NotFound) > 0 {
+			fmt.Printf("  not found in Sonarr (by %s number): %s\n", plan.MatchStrategy, util.FormatEpisodeRanges(plan.NotFound))
+		}
+		if len(plan.UnmappedEpisodes) > 0 {
+			fmt.Printf("  no Sonarr equivalent after episode_mapping: %s\n", util.FormatEpisodeRanges(plan.UnmappedEpisodes))
+		}
+	}
+	if failures > 0 {
+		return exitRunErrors
+	}
+	return exitOK
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFlagExitCodes(t *testing.T) {
+	for _, command := range []string{"run", "plan", "apply", "validate", "list", "explain", "history", "rollback"} {
+		t.Run(command, func(t *testing.T) {
+			if code := runCLI(context.Background(), []string{command, "-h"}); code != exitOK {
+				t.Errorf("kotei %s -h exit code = %d, want %d", command, code, exitOK)
+			}
+			if code := runCLI(context.Background(), []string{command, "--no-such-flag"}); code != exitUsage {
+				t.Errorf("kotei %s --no-such-flag exit code = %d, want %d", command, code, exitUsage)
+			}
+		})
+	}
+	if code := runCLI(context.Background(), []string{"plan", "--dry-run"}); code != exitUsage {
+		t.Errorf("kotei plan --dry-run exit code = %d, want %d", code, exitUsage)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kotei/internal/config"
+	"kotei/internal/processor"
+	"kotei/internal/scheduler"
+	"kotei/internal/state"
+	"kotei/internal/util"
+)
+
+const historyTimeFormat = "2006-01-02 15:04:05"
+
+// openStateForReading opens the state store of appConfig for the history
+// and rollback commands. exitOK with a nil store means nothing was recorded
+// yet.
+func openStateForReading(appConfig config.Config) (*state.Store, int) {
+	if !appConfig.State.Enabled {
+		log.Printf("%s The state store is disabled (state.enabled: false).", util.RedBold("!!! ERROR"))
+		return nil, exitConfigError
+	}
+	store, err := state.OpenExisting(appConfig.State.DataDir)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No runs recorded yet.")
+		return nil, exitOK
+	}
+	if err != nil {
+		log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+		return nil, exitConfigError
+	}
+	return store, exitOK
+}
+
+func runHistoryCommand(args []string) int {
+	var common commonFlags
+	fs := newFlagSet("history", &common, false)
+	limit := fs.Int("limit", 20, "show at most this many runs, or outcomes of the anime entry (0 for all)")
+	runID := fs.String("run", "", "show the anime entries of the run with this ID")
+	format := fs.String("format", "table", "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if fs.NArg() > 1 || (fs.NArg() == 1 && *runID != "") {
+		fmt.Fprintln(os.Stderr, "Usage: kotei history [--config path] [--limit n] [--format table|json] [--run id | <anime>]")
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		log.Printf("%s Unknown --format '%s' (expected table or json).", util.RedBold("!!! ERROR"), *format)
+		return exitUsage
+	}
+
+	appConfig, code := loadConfig(common)
+	if code != exitOK {
+		return code
+	}
+	store, code := openStateForReading(appConfig)
+	if store == nil {
+		return code
+	}
+
+	switch {
+	case *runID != "":
+		run, err := store.Run(*runID)
+		if err != nil {
+			log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+			return exitUsage
+		}
+		if *format == "json" {
+			return writeHistoryJSON(run)
+		}
+		return writeRunDetails(run)
+	case fs.NArg() == 1:
+		return animeHistory(store, appConfig, fs.Arg(0), *limit, *format)
+	}
+
+	runs, err := store.Runs(*limit)
+	if err != nil {
+		log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+		return exitRunErrors
+	}
+	if *format == "json" {
+		return writeHistoryJSON(runs)
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs recorded yet.")
+		return exitOK
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tSTARTED\tTRIGGER\tRESULT\tPROCESSED\tMONITORED\tUNMONITORED\tSEARCHED")
+	for _, run := range runs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+			run.ID, run.StartedAt.Local().Format(historyTimeFormat), run.Trigger, runResult(run), run.Processed,
+			run.Count(processor.ActionMonitor), run.Count(processor.ActionUnmonitor), run.Count(processor.ActionSearch))
+	}
+	if err := tw.Flush(); err != nil {
+		return exitRunErrors
+	}
+	return exitOK
+}
+
+// animeHistory lists the recorded outcomes of one anime entry, found by any
+// of the names the config knows it by.
+func animeHistory(store *state.Store, appConfig config.Config, name string, limit int, format string) int {
+	names := []string{name}
+	if matched, err := config.FilterAnimes(appConfig.Animes, name); err == nil {
+		for _, animeCfg := range matched {
+			names = append(names, animeCfg.DisplayName())
+		}
+	}
+	// All outcomes are read so the summary is not cut short by limit.
+	entries, err := store.AnimeHistory(names, 0)
+	if err != nil {
+		log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+		return exitRunErrors
+	}
+	shown := entries
+	if limit > 0 && len(shown) > limit {
+		shown = shown[:limit]
+	}
+	if format == "json" {
+		return writeHistoryJSON(shown)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No runs recorded for '%s'.\n", name)
+		return exitOK
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tRUN\tTRIGGER\tSTATUS\tCHANGES")
+	for _, entry := range shown {
+		status := entry.Outcome.Status
+		if entry.Run.DryRun {
+			status += " (dry run)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			entry.Outcome.FinishedAt.Local().Format(historyTimeFormat), entry.Run.ID, entry.Run.Trigger, status, describeOutcome(entry.Outcome))
+	}
+	if err := tw.Flush(); err != nil {
+		return exitRunErrors
+	}
+
+	fmt.Println()
+	lastChange := "never"
+	for _, entry := range entries {
+		if !entry.Run.DryRun && len(entry.Outcome.Changes) > 0 {
+			lastChange = fmt.Sprintf("%s (run %s)", entry.Outcome.FinishedAt.Local().Format(historyTimeFormat), entry.Run.ID)
+			break
+		}
+	}
+	fmt.Printf("Last change:   %s\n", lastChange)
+	failing := 0
+	for _, entry := range entries {
+		if entry.Outcome.Status == scheduler.AnimeStatusOK {
+			break
+		}
+		failing++
+	}
+	if failing > 0 {
+		since := entries[failing-1].Outcome.FinishedAt.Local().Format(historyTimeFormat)
+		fmt.Printf("Failing since: %s (%d runs in a row)\n", since, failing)
+	}
+	return exitOK
+}
+
+func writeRunDetails(run state.Run) int {
+	fmt.Printf("Run %s (%s), started %s, %s in %s\n", run.ID, run.Trigger,
+		run.StartedAt.Local().Format(historyTimeFormat), runResult(run), run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond))
+	if run.RollbackOf != "" {
+		fmt.Printf("Rollback of run %s\n", run.RollbackOf)
+	}
+	if run.RolledBackBy != "" {
+		fmt.Printf("Rolled back by run %s\n", run.RolledBackBy)
+	}
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ANIME\tSTATUS\tCHANGES")
+	for _, outcome := range run.Animes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", outcome.Anime, outcome.Status, describeOutcome(outcome))
+	}
+	if err := tw.Flush(); err != nil {
+		return exitRunErrors
+	}
+	return exitOK
+}
+
+func writeHistoryJSON(v any) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return exitRunErrors
+	}
+	return exitOK
+}
+
+func runResult(run state.Run) string {
+	result := run.Result
+	if run.Interrupted {
+		result += " (interrupted)"
+	}
+	if run.DryRun {
+		result += " (dry run)"
+	}
+	if run.RolledBackBy != "" {
+		result += " (rolled back)"
+	}
+	return result
+}
+
+// describeOutcome summarizes the changes of an anime entry as e.g.
+// "monitor 1071-1074; search 1071-1074", or its error.
+func describeOutcome(outcome state.AnimeOutcome) string {
+	var parts []string
+	for _, action := range []processor.Action{processor.ActionMonitor, processor.ActionUnmonitor, processor.ActionSearch} {
+		var numbers []int
+		for _, change := range outcome.Changes {
+			if change.Action == action {
+				numbers = append(numbers, change.Number)
+			}
+		}
+		if len(numbers) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", action, util.FormatEpisodeRanges(numbers)))
+		}
+	}
+	if outcome.Error != "" {
+		parts = append(parts, outcome.Error)
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, "; ")
+}
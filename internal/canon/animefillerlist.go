@@ -0,0 +1,49 @@
+package canon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"kotei/internal/config"
+	"kotei/internal/fillerlist"
+)
+
+// AnimeFillerList scrapes show pages on animefillerlist.com, using the anime
+// entry's `title` as the show slug.
+type AnimeFillerList struct {
+	fetcher *fillerlist.Fetcher
+}
+
+func NewAnimeFillerList(fetcher *fillerlist.Fetcher) *AnimeFillerList {
+	if fetcher == nil {
+		fetcher = fillerlist.NewFetcher("", nil)
+	}
+	return &AnimeFillerList{fetcher: fetcher}
+}
+
+func (s *AnimeFillerList) Name() string { return DefaultSourceName }
+
+func (s *AnimeFillerList) Fetch(ctx context.Context, anime config.AnimeConfig, logger *slog.Logger) (*EpisodeList, error) {
+	if anime.FillerListTitle == "" {
+		return nil, errors.New("animefillerlist source requires a title")
+	}
+	show, err := s.fetcher.FetchShow(ctx, anime.FillerListTitle, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	list := NewEpisodeList(s.Name())
+	for epType, episodes := range show.Categories {
+		list.Categories[Type(epType)] = episodes
+	}
+	for _, ep := range show.Episodes {
+		list.Details[ep.Number] = Episode{
+			Number:  ep.Number,
+			Title:   ep.Title,
+			Type:    Type(ep.Type),
+			AirDate: ep.AirDate,
+		}
+	}
+	return list, nil
+}
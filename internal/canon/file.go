@@ -0,0 +1,161 @@
+package canon
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kotei/internal/config"
+	"kotei/internal/fillerlist"
+	"kotei/internal/logging"
+
+	"github.com/spf13/viper"
+)
+
+const FileSourceName = "file"
+
+// File reads a hand-maintained canon list from the anime entry's
+// `source_file`. YAML files map each category to a list of episode numbers or
+// ranges:
+//
+//	manga: ["1-10", 14]
+//	filler: ["11-13"]
+//
+// CSV files hold one `category,episodes` row per line, where episodes may be a
+// number, a range, or several of either separated by commas or semicolons.
+// Spaces around a range's dash are allowed, as in "1 - 10".
+type File struct{}
+
+func NewFile() *File { return &File{} }
+
+func (s *File) Name() string { return FileSourceName }
+
+func (s *File) Fetch(_ context.Context, anime config.AnimeConfig, logger *slog.Logger) (*EpisodeList, error) {
+	logger = logging.OrDiscard(logger).With(logging.ComponentKey, "filler")
+	path := strings.TrimSpace(anime.SourceFile)
+	if path == "" {
+		return nil, errors.New("file source requires source_file")
+	}
+
+	logger.Info("Reading canon list", "path", path)
+
+	var tokensByType map[Type][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		tokensByType, err = readYAMLCanonFile(path)
+	case ".csv":
+		tokensByType, err = readCSVCanonFile(path)
+	default:
+		return nil, fmt.Errorf("unsupported canon file extension for '%s' (expected .yaml, .yml or .csv)", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := NewEpisodeList(s.Name())
+	for _, t := range []Type{Manga, Mixed, Anime, Filler} {
+		episodes, parseErrors := fillerlist.ParseEpisodeTokens(tokensByType[t])
+		if len(parseErrors) > 0 {
+			logger.Warn("Parse warnings in canon list", "type", string(t), "path", path, "unparsed", parseErrors)
+		}
+		list.Categories[t] = episodes
+	}
+
+	logger.Info("Episode counts",
+		"manga", len(list.Categories[Manga]), "mixed", len(list.Categories[Mixed]),
+		"anime", len(list.Categories[Anime]), "filler", len(list.Categories[Filler]))
+	return list, nil
+}
+
+func parseCategory(name string) (Type, bool) {
+	t := Type(strings.ToLower(strings.TrimSpace(name)))
+	switch t {
+	case Manga, Mixed, Anime, Filler:
+		return t, true
+	}
+	return "", false
+}
+
+// splitEpisodeField splits a list such as "1-10, 14; 20 - 22" on commas and
+// semicolons. Spaces are kept within a token, so ranges may be written with
+// spaces around the dash.
+func splitEpisodeField(field string) []string {
+	var tokens []string
+	for _, token := range strings.FieldsFunc(field, func(r rune) bool { return r == ',' || r == ';' }) {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func readYAMLCanonFile(path string) (map[Type][]string, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read canon file '%s': %w", path, err)
+	}
+
+	tokensByType := make(map[Type][]string)
+	for _, key := range v.AllKeys() {
+		t, ok := parseCategory(key)
+		if !ok {
+			return nil, fmt.Errorf("unknown category '%s' in canon file '%s'", key, path)
+		}
+		switch value := v.Get(key).(type) {
+		case []interface{}:
+			for _, item := range value {
+				tokensByType[t] = append(tokensByType[t], splitEpisodeField(fmt.Sprint(item))...)
+			}
+		case nil:
+		default:
+			tokensByType[t] = append(tokensByType[t], splitEpisodeField(fmt.Sprint(value))...)
+		}
+	}
+	return tokensByType, nil
+}
+
+func readCSVCanonFile(path string) (map[Type][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open canon file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	tokensByType := make(map[Type][]string)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse canon file '%s': %w", path, err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("canon file '%s' line %d: expected 'category,episodes'", path, line)
+		}
+		t, ok := parseCategory(record[0])
+		if !ok {
+			if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "category") {
+				continue
+			}
+			return nil, fmt.Errorf("canon file '%s' line %d: unknown category '%s'", path, line, record[0])
+		}
+		for _, field := range record[1:] {
+			tokensByType[t] = append(tokensByType[t], splitEpisodeField(field)...)
+		}
+	}
+	return tokensByType, nil
+}
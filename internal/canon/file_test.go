@@ -0,0 +1,87 @@
+package canon
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kotei/internal/config"
+)
+
+func TestSplitEpisodeField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		{field: "12", want: []string{"12"}},
+		{field: "1-10", want: []string{"1-10"}},
+		{field: "1 - 10", want: []string{"1 - 10"}},
+		{field: "1-10,14", want: []string{"1-10", "14"}},
+		{field: " 1-10 ; 14, 20 - 22 ", want: []string{"1-10", "14", "20 - 22"}},
+		{field: "1,,2;;", want: []string{"1", "2"}},
+		{field: " ", want: nil},
+	}
+	for _, tt := range tests {
+		if got := splitEpisodeField(tt.field); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitEpisodeField(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestFileFetch(t *testing.T) {
+	want := map[Type][]int{
+		Manga:  {1, 2, 3, 4, 5, 8, 10, 11, 12},
+		Mixed:  {13, 14, 15},
+		Anime:  {},
+		Filler: {6, 7, 9},
+	}
+	wantCSV := map[Type][]int{
+		Manga:  {1, 2, 3, 4, 5, 8, 10, 11, 12, 16},
+		Mixed:  {13, 14, 15},
+		Anime:  {},
+		Filler: {6, 7, 9},
+	}
+	tests := []struct {
+		file    string
+		want    map[Type][]int
+		wantErr string
+	}{
+		{file: "canon.yaml", want: want},
+		{file: "canon.csv", want: wantCSV},
+		{file: "unknown.yaml", wantErr: "unknown category 'specials'"},
+		{file: "unknown.csv", wantErr: "line 2: unknown category 'specials'"},
+		{file: "short.csv", wantErr: "line 1: expected 'category,episodes'"},
+		{file: "missing.yaml", wantErr: "failed to read canon file"},
+		{file: "canon.json", wantErr: "unsupported canon file extension"},
+		{file: "canon.txt", wantErr: "unsupported canon file extension"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			anime := config.AnimeConfig{Source: FileSourceName, SourceFile: filepath.Join("testdata", tt.file)}
+			list, err := NewFile().Fetch(context.Background(), anime, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Fetch() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			if list.Source != FileSourceName {
+				t.Errorf("Source = %q, want %q", list.Source, FileSourceName)
+			}
+			if !reflect.DeepEqual(list.Categories, tt.want) {
+				t.Errorf("Categories = %v, want %v", list.Categories, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileFetchRequiresPath(t *testing.T) {
+	if _, err := NewFile().Fetch(context.Background(), config.AnimeConfig{Source: FileSourceName}, nil); err == nil {
+		t.Fatal("Fetch() without source_file succeeded")
+	}
+}
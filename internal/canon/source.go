@@ -0,0 +1,152 @@
+package canon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kotei/internal/config"
+	"kotei/internal/fillerlist"
+	"kotei/internal/logging"
+)
+
+var NilLogger = logging.Discard()
+
+type Type string
+
+const (
+	Manga  Type = "manga"
+	Mixed  Type = "mixed"
+	Anime  Type = "anime"
+	Filler Type = "filler"
+)
+
+// CanonTypes are the categories selected when include_canon_types is empty.
+var CanonTypes = []Type{Manga, Mixed, Anime}
+
+// Episode carries the optional per-episode details a source may know about.
+type Episode struct {
+	Number  int
+	Title   string
+	Type    Type
+	AirDate time.Time
+}
+
+// EpisodeList is the categorized episode list of a single show.
+type EpisodeList struct {
+	Source     string
+	Categories map[Type][]int
+	Details    map[int]Episode
+}
+
+func NewEpisodeList(sourceName string) *EpisodeList {
+	return &EpisodeList{
+		Source:     sourceName,
+		Categories: make(map[Type][]int),
+		Details:    make(map[int]Episode),
+	}
+}
+
+// Select returns the sorted, de-duplicated episode numbers of the given types.
+// Unknown type names are ignored; an empty selection means all canon types.
+func (l *EpisodeList) Select(includeTypes []string) []int {
+	selected := make(map[int]bool)
+	for _, t := range ParseTypes(includeTypes) {
+		for _, ep := range l.Categories[t] {
+			selected[ep] = true
+		}
+	}
+	episodes := make([]int, 0, len(selected))
+	for ep := range selected {
+		episodes = append(episodes, ep)
+	}
+	sort.Ints(episodes)
+	return episodes
+}
+
+// ParseTypes normalizes include_canon_types values, falling back to
+// CanonTypes when none are valid.
+func ParseTypes(includeTypes []string) []Type {
+	var types []Type
+	seen := make(map[Type]bool)
+	for _, raw := range includeTypes {
+		t := Type(strings.ToLower(strings.TrimSpace(raw)))
+		switch t {
+		case Manga, Mixed, Anime:
+			if !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	if len(types) == 0 {
+		return CanonTypes
+	}
+	return types
+}
+
+// Source provides the categorized episode list for a configured anime.
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context, anime config.AnimeConfig, logger *slog.Logger) (*EpisodeList, error)
+}
+
+const DefaultSourceName = "animefillerlist"
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Source{
+		DefaultSourceName: NewAnimeFillerList(nil),
+		FileSourceName:    NewFile(),
+	}
+)
+
+// Configure applies the global source settings from the config, such as the
+// AnimeFillerList page cache. It should be called once at startup.
+func Configure(cfg config.Config, logger *slog.Logger) {
+	logger = logging.OrDiscard(logger)
+	var cache *fillerlist.Cache
+	if cfg.FillerList.CacheEnabled {
+		ttl := time.Duration(cfg.FillerList.CacheTTLMinutes) * time.Minute
+		var err error
+		cache, err = fillerlist.NewCache(cfg.FillerList.CacheDir, ttl)
+		if err != nil {
+			logger.Warn("AnimeFillerList cache disabled", "error", err)
+			cache = nil
+		}
+	}
+	Register(NewAnimeFillerList(fillerlist.NewFetcher("", cache)))
+}
+
+// Register makes a source selectable through the `source` field of an anime
+// entry, replacing any source previously registered under the same name.
+func Register(source Source) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(source.Name())] = source
+}
+
+// Get returns the source registered under name.
+func Get(name string) (Source, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	source, ok := registry[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown canon source '%s'", name)
+	}
+	return source, nil
+}
+
+// ForAnime returns the source selected by an anime entry, defaulting to
+// AnimeFillerList.
+func ForAnime(anime config.AnimeConfig) (Source, error) {
+	name := anime.Source
+	if strings.TrimSpace(name) == "" {
+		name = DefaultSourceName
+	}
+	return Get(name)
+}
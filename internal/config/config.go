@@ -1,18 +1,209 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
+const (
+	SyncModeMonitor = "monitor"
+	SyncModeStrict  = "strict"
+
+	DefaultMaxUnmonitorPercent = 25
+)
+
+type EpisodeMappingRange struct {
+	FillerList string `mapstructure:"fillerlist"`
+	Sonarr     string `mapstructure:"sonarr"`
+}
+
+type EpisodeMapping struct {
+	Offset int                   `mapstructure:"offset"`
+	Ranges []EpisodeMappingRange `mapstructure:"ranges"`
+}
+
 type AnimeConfig struct {
-	FillerListTitle   string   `mapstructure:"title"`
-	SonarrTitle       string   `mapstructure:"sonarr_title"`
-	IncludeCanonTypes []string `mapstructure:"include_canon_types"`
-	CutoffEpisode     int      `mapstructure:"cutoff_episode"`
-	SearchEnabled     bool     `mapstructure:"search_enabled"`
+	FillerListTitle     string         `mapstructure:"title"`
+	SonarrTitle         string         `mapstructure:"sonarr_title"`
+	TvdbID              int            `mapstructure:"tvdb_id"`
+	SonarrID            int            `mapstructure:"sonarr_id"`
+	IncludeCanonTypes   []string       `mapstructure:"include_canon_types"`
+	CutoffEpisode       int            `mapstructure:"cutoff_episode"`
+	SearchEnabled       bool           `mapstructure:"search_enabled"`
+	SyncMode            string         `mapstructure:"sync_mode"`
+	MaxUnmonitorPercent int            `mapstructure:"max_unmonitor_percent"`
+	Source              string         `mapstructure:"source"`
+	SourceFile          string         `mapstructure:"source_file"`
+	EpisodeMapping      EpisodeMapping `mapstructure:"episode_mapping"`
+	MatchBy             string         `mapstructure:"match_by"`
+	Schedule            string         `mapstructure:"schedule"`
+}
+
+// DisplayName returns the most readable identifier of the entry for logs.
+func (a AnimeConfig) DisplayName() string {
+	switch {
+	case a.SonarrTitle != "":
+		return a.SonarrTitle
+	case a.FillerListTitle != "":
+		return a.FillerListTitle
+	case a.SonarrID != 0:
+		return fmt.Sprintf("sonarr_id %d", a.SonarrID)
+	case a.TvdbID != 0:
+		return fmt.Sprintf("tvdb_id %d", a.TvdbID)
+	}
+	return "(unnamed)"
+}
+
+// CronSpec returns the entry's own cron spec, or globalSpec when it has none.
+func (a AnimeConfig) CronSpec(globalSpec string) string {
+	if spec := strings.TrimSpace(a.Schedule); spec != "" {
+		return spec
+	}
+	return strings.TrimSpace(globalSpec)
+}
+
+// IsStrict reports whether episodes outside the canon set should also be
+// unmonitored in Sonarr.
+func (a AnimeConfig) IsStrict() bool {
+	return strings.EqualFold(strings.TrimSpace(a.SyncMode), SyncModeStrict)
+}
+
+// UnmonitorLimitPercent returns the largest share of a series that strict
+// mode may unmonitor in a single run.
+func (a AnimeConfig) UnmonitorLimitPercent() int {
+	if a.MaxUnmonitorPercent <= 0 {
+		return DefaultMaxUnmonitorPercent
+	}
+	return a.MaxUnmonitorPercent
+}
+
+// ErrNoAnimeMatch is returned by FilterAnimes when no entry matches.
+var ErrNoAnimeMatch = errors.New("no anime entry matches")
+
+// FilterAnimes returns the entries whose title, sonarr_title or display name
+// equals only, ignoring case.
+func FilterAnimes(animes []AnimeConfig, only string) ([]AnimeConfig, error) {
+	var matched []AnimeConfig
+	for _, animeCfg := range animes {
+		if strings.EqualFold(animeCfg.FillerListTitle, only) ||
+			strings.EqualFold(animeCfg.SonarrTitle, only) ||
+			strings.EqualFold(animeCfg.DisplayName(), only) {
+			matched = append(matched, animeCfg)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w '%s'", ErrNoAnimeMatch, only)
+	}
+	return matched, nil
+}
+
+// WebhookConfig is a generic HTTP notification target. Body is a Go
+// text/template rendered with the event; when empty the event is sent as
+// JSON.
+type WebhookConfig struct {
+	Name           string            `mapstructure:"name"`
+	URL            string            `mapstructure:"url"`
+	Method         string            `mapstructure:"method"`
+	Headers        map[string]string `mapstructure:"headers"`
+	Body           string            `mapstructure:"body"`
+	Events         []string          `mapstructure:"events"`
+	TimeoutSeconds int               `mapstructure:"timeout_seconds"`
+}
+
+// DisplayName returns the webhook's name, or its URL when unnamed.
+func (w WebhookConfig) DisplayName() string {
+	if w.Name != "" {
+		return w.Name
+	}
+	return w.URL
 }
+
+// ChatConfig is a Discord or Slack incoming webhook that receives one
+// summary message per run.
+type ChatConfig struct {
+	Name       string `mapstructure:"name"`
+	WebhookURL string `mapstructure:"webhook_url"`
+	// NotifyQuietRuns also sends runs that changed nothing and had no errors.
+	NotifyQuietRuns bool `mapstructure:"notify_quiet_runs"`
+}
+
+// DisplayName returns the target's name, or "default" when unnamed; the
+// webhook URL is a secret and never logged.
+func (c ChatConfig) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return "default"
+}
+
+// DefaultNtfyURL is the public ntfy server, used when an ntfy target has no
+// url.
+const DefaultNtfyURL = "https://ntfy.sh"
+
+// PushConfig is an ntfy topic or a Gotify application that receives one push
+// message per anime entry with changes or problems.
+type PushConfig struct {
+	Name  string `mapstructure:"name"`
+	URL   string `mapstructure:"url"`
+	Topic string `mapstructure:"topic"`
+	Token string `mapstructure:"token"`
+	// Tags are added to every ntfy message, e.g. emoji short codes.
+	Tags []string `mapstructure:"tags"`
+}
+
+// DisplayName returns the target's name, or its topic or server when unnamed.
+func (p PushConfig) DisplayName() string {
+	switch {
+	case p.Name != "":
+		return p.Name
+	case p.Topic != "":
+		return p.Topic
+	}
+	return p.URL
+}
+
+const (
+	SMTPSecuritySTARTTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+	SMTPSecurityNone     = "none"
+
+	DigestImmediate = "immediate"
+	DigestDaily     = "daily"
+	DigestWeekly    = "weekly"
+)
+
+// EmailConfig is the SMTP server and recipients of the email digest, which
+// is enabled by setting Host.
+type EmailConfig struct {
+	Host           string   `mapstructure:"host"`
+	Port           int      `mapstructure:"port"`
+	Security       string   `mapstructure:"security"`
+	Username       string   `mapstructure:"username"`
+	Password       string   `mapstructure:"password"`
+	From           string   `mapstructure:"from"`
+	To             []string `mapstructure:"to"`
+	Digest         string   `mapstructure:"digest"`
+	TimeoutSeconds int      `mapstructure:"timeout_seconds"`
+}
+
+// SMTPPort returns the configured port, or the usual one for Security.
+func (e EmailConfig) SMTPPort() int {
+	switch {
+	case e.Port != 0:
+		return e.Port
+	case e.Security == SMTPSecurityTLS:
+		return 465
+	case e.Security == SMTPSecurityNone:
+		return 25
+	}
+	return 587
+}
+
 type Config struct {
 	DryRun bool `mapstructure:"dry_run"`
 	Sonarr struct {
@@ -23,42 +214,97 @@ type Config struct {
 		RetryCount       int    `mapstructure:"retry_count"`
 		RetryWaitSeconds int    `mapstructure:"retry_wait_seconds"`
 	} `mapstructure:"sonarr"`
+	FillerList struct {
+		CacheEnabled    bool   `mapstructure:"cache_enabled"`
+		CacheDir        string `mapstructure:"cache_dir"`
+		CacheTTLMinutes int    `mapstructure:"cache_ttl_minutes"`
+	} `mapstructure:"fillerlist"`
 	Animes   []AnimeConfig `mapstructure:"animes"`
 	Schedule struct {
-		CronSpec string `mapstructure:"cron_spec"`
+		CronSpec               string `mapstructure:"cron_spec"`
+		ShutdownTimeoutSeconds int    `mapstructure:"shutdown_timeout_seconds"`
 	} `mapstructure:"schedule"`
+	Log struct {
+		Format string `mapstructure:"format"`
+		Level  string `mapstructure:"level"`
+	} `mapstructure:"log"`
+	Server struct {
+		Enabled bool   `mapstructure:"enabled"`
+		Listen  string `mapstructure:"listen"`
+		// Token, when set, is required as a bearer token by POST /api/run.
+		Token string `mapstructure:"token"`
+	} `mapstructure:"server"`
+	State struct {
+		Enabled bool   `mapstructure:"enabled"`
+		DataDir string `mapstructure:"data_dir"`
+	} `mapstructure:"state"`
+	Notifications struct {
+		Webhooks []WebhookConfig `mapstructure:"webhooks"`
+		Discord  []ChatConfig    `mapstructure:"discord"`
+		Slack    []ChatConfig    `mapstructure:"slack"`
+		Email    EmailConfig     `mapstructure:"email"`
+		Ntfy     []PushConfig    `mapstructure:"ntfy"`
+		Gotify   []PushConfig    `mapstructure:"gotify"`
+	} `mapstructure:"notifications"`
+}
+
+const (
+	DefaultConfigPath = "./config.yaml"
+	EnvPrefix         = "KOTEI"
+	ConfigPathEnv     = EnvPrefix + "_CONFIG"
+)
+
+// DefaultPath returns the config path from KOTEI_CONFIG, or DefaultConfigPath.
+func DefaultPath() string {
+	if path := os.Getenv(ConfigPathEnv); path != "" {
+		return path
+	}
+	return DefaultConfigPath
 }
 
-func LoadConfig() (Config, error) {
+// LoadConfig reads the config file at path, or DefaultPath when empty, and
+// applies KOTEI_* environment overrides. The result is not validated; see
+// Config.Validate.
+func LoadConfig(path string) (Config, error) {
 	var cfg Config
 
-	viper.SetConfigFile("./config.yaml")
+	if path == "" {
+		path = DefaultPath()
+	}
+	// A fresh instance per load keeps reloads from racing with the file
+	// watcher, which reads the file through its own instance.
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
 
-	viper.SetDefault("sonarr.api_path", "/api/v3")
-	viper.SetDefault("sonarr.timeout_seconds", 15)
-	viper.SetDefault("sonarr.retry_count", 3)
-	viper.SetDefault("sonarr.retry_wait_seconds", 5)
+	v.SetDefault("sonarr.api_path", "/api/v3")
+	v.SetDefault("sonarr.timeout_seconds", 15)
+	v.SetDefault("sonarr.retry_count", 3)
+	v.SetDefault("sonarr.retry_wait_seconds", 5)
+	v.SetDefault("fillerlist.cache_enabled", true)
+	v.SetDefault("fillerlist.cache_ttl_minutes", 360)
+	v.SetDefault("log.format", "text")
+	v.SetDefault("log.level", "info")
+	v.SetDefault("server.listen", "127.0.0.1:8080")
+	v.SetDefault("schedule.shutdown_timeout_seconds", 8)
+	v.SetDefault("state.enabled", true)
+	v.SetDefault("notifications.email.security", SMTPSecuritySTARTTLS)
+	v.SetDefault("notifications.email.digest", DigestImmediate)
 
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			log.Fatalf("FATAL: Config file (config.yaml) not found.")
-		} else {
-			log.Fatalf("FATAL: Error reading config file: %v", err)
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) || errors.Is(err, fs.ErrNotExist) {
+			return cfg, fmt.Errorf("config file (%s) not found", path)
 		}
+		return cfg, fmt.Errorf("error reading config file %s: %w", path, err)
 	}
 
-	if err := viper.Unmarshal(&cfg); err != nil {
-		log.Fatalf("FATAL: Unable to decode config: %v", err)
+	if err := bindEnv(v); err != nil {
+		return cfg, err
 	}
 
-	if cfg.Sonarr.BaseURL == "" {
-		log.Fatal("FATAL: Critical config: sonarr.baseurl is not set.")
-	}
-	if cfg.Sonarr.APIKey == "" {
-		log.Fatal("FATAL: Critical config: sonarr.apikey is not set.")
-	}
-	if len(cfg.Animes) == 0 {
-		log.Fatal("FATAL: Critical config: no entries found in 'animes' list.")
+	if err := v.Unmarshal(&cfg); err != nil {
+		return cfg, fmt.Errorf("unable to decode config %s: %w", path, err)
 	}
 
 	return cfg, nil
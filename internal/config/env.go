@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvName returns the environment variable that overrides a config key, e.g.
+// "sonarr.apikey" becomes KOTEI_SONARR_APIKEY.
+func EnvName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// envKey is a config key that can be set from the environment. List keys
+// take comma-separated values.
+type envKey struct {
+	name string
+	list bool
+}
+
+// envKeys lists the dotted keys of every scalar field, and every list of
+// scalars, reachable from t through nested structs. Lists of entries such as
+// `animes` or `notifications.webhooks`, and maps, cannot be overridden from
+// the environment.
+func envKeys(t reflect.Type, prefix string) []envKey {
+	var keys []envKey
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			keys = append(keys, envKeys(field.Type, key)...)
+		case reflect.Slice:
+			switch field.Type.Elem().Kind() {
+			case reflect.Struct, reflect.Map, reflect.Slice, reflect.Pointer, reflect.Interface:
+			default:
+				keys = append(keys, envKey{name: key, list: true})
+			}
+		case reflect.Map:
+		default:
+			keys = append(keys, envKey{name: key})
+		}
+	}
+	return keys
+}
+
+// splitList splits a comma-separated list value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// bindEnv makes every scalar config key, and every list of scalars,
+// overridable through KOTEI_<KEY>, or through KOTEI_<KEY>_FILE naming a file
+// whose contents are used instead, as with Docker and Kubernetes secrets. A
+// plain variable wins over its _FILE variant.
+func bindEnv(v *viper.Viper) error {
+	for _, key := range envKeys(reflect.TypeOf(Config{}), "") {
+		envName := EnvName(key.name)
+		if err := v.BindEnv(key.name, envName); err != nil {
+			return fmt.Errorf("failed to bind %s: %w", envName, err)
+		}
+		value, fromEnv := os.LookupEnv(envName)
+		if !fromEnv {
+			secretPath, set := os.LookupEnv(envName + "_FILE")
+			if !set || secretPath == "" {
+				continue
+			}
+			secret, err := os.ReadFile(secretPath)
+			if err != nil {
+				return fmt.Errorf("failed to read %s_FILE: %w", envName, err)
+			}
+			value = strings.TrimRight(string(secret), "\r\n")
+		}
+		switch {
+		case key.list:
+			v.Set(key.name, splitList(value))
+		case !fromEnv:
+			v.Set(key.name, value)
+		}
+	}
+	return nil
+}
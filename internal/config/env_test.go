@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const envTestConfig = `sonarr:
+  baseurl: http://localhost:8989
+  apikey: from-file
+notifications:
+  email:
+    host: smtp.example.com
+    to: ["file@example.com"]
+animes:
+  - title: one-piece
+`
+
+func writeEnvTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvKeys(t *testing.T) {
+	keys := make(map[string]bool)
+	for _, key := range envKeys(reflect.TypeOf(Config{}), "") {
+		keys[key.name] = key.list
+	}
+	for name, list := range map[string]bool{
+		"sonarr.apikey":              false,
+		"schedule.cron_spec":         false,
+		"notifications.email.host":   false,
+		"notifications.email.to":     true,
+		"notifications.email.port":   false,
+		"state.enabled":              false,
+		"server.token":               false,
+		"fillerlist.cache_enabled":   false,
+		"notifications.email.digest": false,
+	} {
+		got, ok := keys[name]
+		if !ok || got != list {
+			t.Errorf("envKeys has %s: %t, list: %t; want list: %t", name, ok, got, list)
+		}
+	}
+	for _, name := range []string{"animes", "notifications.webhooks", "notifications.discord", "notifications.ntfy"} {
+		if _, ok := keys[name]; ok {
+			t.Errorf("envKeys has %s, a list of entries", name)
+		}
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		fileEnv    map[string]string // variables set to a file with the value
+		wantAPIKey string
+		wantCron   string
+		wantPort   int
+		wantTo     []string
+	}{
+		{
+			name:       "config file only",
+			wantAPIKey: "from-file",
+			wantTo:     []string{"file@example.com"},
+		},
+		{
+			name: "nested keys",
+			env: map[string]string{
+				"KOTEI_SONARR_APIKEY":            "from-env",
+				"KOTEI_SCHEDULE_CRON_SPEC":       "0 3 * * *",
+				"KOTEI_NOTIFICATIONS_EMAIL_PORT": "2525",
+				"KOTEI_NOTIFICATIONS_EMAIL_TO":   "a@example.com, b@example.com,",
+			},
+			wantAPIKey: "from-env",
+			wantCron:   "0 3 * * *",
+			wantPort:   2525,
+			wantTo:     []string{"a@example.com", "b@example.com"},
+		},
+		{
+			name: "_FILE variants",
+			fileEnv: map[string]string{
+				"KOTEI_SONARR_APIKEY_FILE":          "secret\n",
+				"KOTEI_NOTIFICATIONS_EMAIL_TO_FILE": "a@example.com,b@example.com\n",
+			},
+			wantAPIKey: "secret",
+			wantTo:     []string{"a@example.com", "b@example.com"},
+		},
+		{
+			name:       "a plain variable wins over _FILE",
+			env:        map[string]string{"KOTEI_SONARR_APIKEY": "from-env"},
+			fileEnv:    map[string]string{"KOTEI_SONARR_APIKEY_FILE": "secret"},
+			wantAPIKey: "from-env",
+			wantTo:     []string{"file@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			for name, value := range tt.fileEnv {
+				t.Setenv(name, writeEnvTestFile(t, "secret", value))
+			}
+			cfg, err := LoadConfig(writeEnvTestFile(t, "config.yaml", envTestConfig))
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if cfg.Sonarr.APIKey != tt.wantAPIKey {
+				t.Errorf("sonarr.apikey = %q, want %q", cfg.Sonarr.APIKey, tt.wantAPIKey)
+			}
+			if cfg.Schedule.CronSpec != tt.wantCron {
+				t.Errorf("schedule.cron_spec = %q, want %q", cfg.Schedule.CronSpec, tt.wantCron)
+			}
+			if cfg.Notifications.Email.Port != tt.wantPort {
+				t.Errorf("notifications.email.port = %d, want %d", cfg.Notifications.Email.Port, tt.wantPort)
+			}
+			if !reflect.DeepEqual(cfg.Notifications.Email.To, tt.wantTo) {
+				t.Errorf("notifications.email.to = %q, want %q", cfg.Notifications.Email.To, tt.wantTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ValidationError is a single problem found in the config, located by its
+// YAML path such as "animes[2].include_canon_types[0]".
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors collects every problem found in a config.
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, 0, len(errs))
+	for _, e := range errs {
+		lines = append(lines, e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs *ValidationErrors) Add(path string, format string, args ...interface{}) {
+	*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// AnimePath returns the YAML path of an anime entry, optionally followed by a
+// field name.
+func AnimePath(index int, field string) string {
+	if field == "" {
+		return fmt.Sprintf("animes[%d]", index)
+	}
+	return fmt.Sprintf("animes[%d].%s", index, field)
+}
+
+var validCanonTypes = map[string]bool{"manga": true, "mixed": true, "anime": true}
+
+// Validate checks the config for problems that do not depend on other
+// packages, returning all of them at once.
+func (c Config) Validate() ValidationErrors {
+	var errs ValidationErrors
+
+	if strings.TrimSpace(c.Sonarr.BaseURL) == "" {
+		errs.Add("sonarr.baseurl", "is required")
+	} else if u, err := url.Parse(c.Sonarr.BaseURL); err != nil {
+		errs.Add("sonarr.baseurl", "invalid URL: %v", err)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("sonarr.baseurl", "must be an absolute http(s) URL, got '%s'", c.Sonarr.BaseURL)
+	}
+	if strings.TrimSpace(c.Sonarr.APIKey) == "" {
+		errs.Add("sonarr.apikey", "is required")
+	}
+	if c.Sonarr.APIPath != "" && !strings.HasPrefix(c.Sonarr.APIPath, "/") {
+		errs.Add("sonarr.api_path", "must start with '/', got '%s'", c.Sonarr.APIPath)
+	}
+	if c.Sonarr.TimeoutSeconds <= 0 {
+		errs.Add("sonarr.timeout_seconds", "must be positive, got %d", c.Sonarr.TimeoutSeconds)
+	}
+	if c.Sonarr.RetryCount < 0 {
+		errs.Add("sonarr.retry_count", "must not be negative, got %d", c.Sonarr.RetryCount)
+	}
+	if c.Sonarr.RetryWaitSeconds < 0 {
+		errs.Add("sonarr.retry_wait_seconds", "must not be negative, got %d", c.Sonarr.RetryWaitSeconds)
+	}
+
+	if c.FillerList.CacheTTLMinutes < 0 {
+		errs.Add("fillerlist.cache_ttl_minutes", "must not be negative, got %d", c.FillerList.CacheTTLMinutes)
+	}
+
+	if spec := strings.TrimSpace(c.Schedule.CronSpec); spec != "" {
+		if _, err := cron.ParseStandard(spec); err != nil {
+			errs.Add("schedule.cron_spec", "invalid cron spec '%s': %v", spec, err)
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.Log.Format)) {
+	case "", "text", "json":
+	default:
+		errs.Add("log.format", "unknown format '%s' (expected text or json)", c.Log.Format)
+	}
+	switch strings.ToLower(strings.TrimSpace(c.Log.Level)) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		errs.Add("log.level", "unknown level '%s' (expected debug, info, warn or error)", c.Log.Level)
+	}
+
+	if c.Schedule.ShutdownTimeoutSeconds < 0 {
+		errs.Add("schedule.shutdown_timeout_seconds", "must not be negative, got %d", c.Schedule.ShutdownTimeoutSeconds)
+	}
+
+	if c.Server.Enabled {
+		if _, _, err := net.SplitHostPort(c.Server.Listen); err != nil {
+			errs.Add("server.listen", "invalid address '%s', expected host:port such as '127.0.0.1:8080'", c.Server.Listen)
+		}
+	}
+
+	for i, webhook := range c.Notifications.Webhooks {
+		path := fmt.Sprintf("notifications.webhooks[%d]", i)
+		if strings.TrimSpace(webhook.URL) == "" {
+			errs.Add(path+".url", "is required")
+		} else if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.Add(path+".url", "must be an absolute http(s) URL, got '%s'", webhook.URL)
+		}
+		switch strings.ToUpper(strings.TrimSpace(webhook.Method)) {
+		case "", "POST", "PUT", "PATCH", "GET":
+		default:
+			errs.Add(path+".method", "unsupported method '%s' (expected POST, PUT, PATCH or GET)", webhook.Method)
+		}
+		if webhook.TimeoutSeconds < 0 {
+			errs.Add(path+".timeout_seconds", "must not be negative, got %d", webhook.TimeoutSeconds)
+		}
+	}
+
+	for _, chats := range []struct {
+		kind    string
+		targets []ChatConfig
+	}{{"discord", c.Notifications.Discord}, {"slack", c.Notifications.Slack}} {
+		for i, chat := range chats.targets {
+			path := fmt.Sprintf("notifications.%s[%d].webhook_url", chats.kind, i)
+			if strings.TrimSpace(chat.WebhookURL) == "" {
+				errs.Add(path, "is required")
+			} else if u, err := url.Parse(chat.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs.Add(path, "must be an absolute http(s) URL")
+			}
+		}
+	}
+
+	for i, ntfy := range c.Notifications.Ntfy {
+		path := fmt.Sprintf("notifications.ntfy[%d]", i)
+		if strings.TrimSpace(ntfy.Topic) == "" {
+			errs.Add(path+".topic", "is required")
+		}
+		if ntfy.URL != "" {
+			if u, err := url.Parse(ntfy.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs.Add(path+".url", "must be an absolute http(s) URL, got '%s'", ntfy.URL)
+			}
+		}
+	}
+	for i, gotify := range c.Notifications.Gotify {
+		path := fmt.Sprintf("notifications.gotify[%d]", i)
+		if strings.TrimSpace(gotify.URL) == "" {
+			errs.Add(path+".url", "is required")
+		} else if u, err := url.Parse(gotify.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.Add(path+".url", "must be an absolute http(s) URL, got '%s'", gotify.URL)
+		}
+		if strings.TrimSpace(gotify.Token) == "" {
+			errs.Add(path+".token", "is required (the application token)")
+		}
+	}
+
+	if email := c.Notifications.Email; strings.TrimSpace(email.Host) != "" {
+		if email.Port < 0 || email.Port > 65535 {
+			errs.Add("notifications.email.port", "must be between 1 and 65535, got %d", email.Port)
+		}
+		switch email.Security {
+		case SMTPSecuritySTARTTLS, SMTPSecurityTLS, SMTPSecurityNone:
+		default:
+			errs.Add("notifications.email.security", "unknown mode '%s' (expected %s, %s or %s)", email.Security, SMTPSecuritySTARTTLS, SMTPSecurityTLS, SMTPSecurityNone)
+		}
+		switch email.Digest {
+		case DigestImmediate, DigestDaily, DigestWeekly:
+		default:
+			errs.Add("notifications.email.digest", "unknown digest '%s' (expected %s, %s or %s)", email.Digest, DigestImmediate, DigestDaily, DigestWeekly)
+		}
+		if _, err := mail.ParseAddress(email.From); err != nil {
+			errs.Add("notifications.email.from", "invalid address '%s': %v", email.From, err)
+		}
+		if len(email.To) == 0 {
+			errs.Add("notifications.email.to", "needs at least one recipient")
+		}
+		for i, to := range email.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				errs.Add(fmt.Sprintf("notifications.email.to[%d]", i), "invalid address '%s': %v", to, err)
+			}
+		}
+		if email.TimeoutSeconds < 0 {
+			errs.Add("notifications.email.timeout_seconds", "must not be negative, got %d", email.TimeoutSeconds)
+		}
+	}
+
+	if len(c.Animes) == 0 {
+		errs.Add("animes", "no entries found")
+	}
+	seenTitles := make(map[string]int)
+	seenSonarr := make(map[string]int)
+	for i, anime := range c.Animes {
+		anime.validate(i, &errs)
+		if strings.TrimSpace(anime.Schedule) != "" && strings.TrimSpace(c.Schedule.CronSpec) == "" {
+			errs.Add(AnimePath(i, "schedule"), "requires schedule.cron_spec, which enables scheduler mode")
+		}
+
+		if title := strings.ToLower(strings.TrimSpace(anime.FillerListTitle)); title != "" {
+			if first, ok := seenTitles[title]; ok {
+				errs.Add(AnimePath(i, "title"), "duplicate of %s", AnimePath(first, ""))
+			} else {
+				seenTitles[title] = i
+			}
+		}
+		if key := anime.sonarrKey(); key != "" {
+			if first, ok := seenSonarr[key]; ok {
+				errs.Add(AnimePath(i, ""), "targets the same Sonarr series as %s", AnimePath(first, ""))
+			} else {
+				seenSonarr[key] = i
+			}
+		}
+	}
+	return errs
+}
+
+func (a AnimeConfig) sonarrKey() string {
+	switch {
+	case a.SonarrID != 0:
+		return fmt.Sprintf("sonarr_id:%d", a.SonarrID)
+	case a.TvdbID != 0:
+		return fmt.Sprintf("tvdb_id:%d", a.TvdbID)
+	case strings.TrimSpace(a.SonarrTitle) != "":
+		return "title:" + strings.ToLower(strings.TrimSpace(a.SonarrTitle))
+	}
+	return ""
+}
+
+func (a AnimeConfig) validate(i int, errs *ValidationErrors) {
+	if strings.TrimSpace(a.SonarrTitle) == "" && a.TvdbID == 0 && a.SonarrID == 0 {
+		errs.Add(AnimePath(i, ""), "one of sonarr_title, tvdb_id or sonarr_id is required")
+	}
+	if a.TvdbID < 0 {
+		errs.Add(AnimePath(i, "tvdb_id"), "must not be negative, got %d", a.TvdbID)
+	}
+	if a.SonarrID < 0 {
+		errs.Add(AnimePath(i, "sonarr_id"), "must not be negative, got %d", a.SonarrID)
+	}
+	for j, t := range a.IncludeCanonTypes {
+		if !validCanonTypes[strings.ToLower(strings.TrimSpace(t))] {
+			errs.Add(AnimePath(i, fmt.Sprintf("include_canon_types[%d]", j)), "unknown type '%s' (expected manga, mixed or anime)", t)
+		}
+	}
+	if a.CutoffEpisode < 0 {
+		errs.Add(AnimePath(i, "cutoff_episode"), "must not be negative, got %d", a.CutoffEpisode)
+	}
+	switch strings.ToLower(strings.TrimSpace(a.SyncMode)) {
+	case "", SyncModeMonitor, SyncModeStrict:
+	default:
+		errs.Add(AnimePath(i, "sync_mode"), "unknown mode '%s' (expected %s or %s)", a.SyncMode, SyncModeMonitor, SyncModeStrict)
+	}
+	if a.MaxUnmonitorPercent < 0 || a.MaxUnmonitorPercent > 100 {
+		errs.Add(AnimePath(i, "max_unmonitor_percent"), "must be between 0 and 100, got %d", a.MaxUnmonitorPercent)
+	}
+	if spec := strings.TrimSpace(a.Schedule); spec != "" {
+		if _, err := cron.ParseStandard(spec); err != nil {
+			errs.Add(AnimePath(i, "schedule"), "invalid cron spec '%s': %v", spec, err)
+		}
+	}
+}
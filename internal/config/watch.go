@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"kotei/internal/logging"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// reloadDebounce folds the burst of events an editor produces while saving
+// into a single reload.
+const reloadDebounce = 500 * time.Millisecond
+
+// Watch calls onChange whenever the config file at path, or DefaultPath when
+// empty, is written or replaced, including Kubernetes ConfigMap updates. It
+// keeps watching until the process exits; onChange loads and validates the
+// file itself. An error means the file cannot be watched.
+func Watch(path string, logger *slog.Logger, onChange func()) error {
+	if path == "" {
+		path = DefaultPath()
+	}
+	// Viper watches the directory of the file, which a bare file name such
+	// as "config.yaml" would leave empty.
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	// Viper announces every read at info level; keep only its problems.
+	v := viper.NewWithOptions(viper.WithLogger(logging.AtLeast(logger, slog.LevelWarn)))
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+
+	var mu sync.Mutex
+	var timer *time.Timer
+	v.OnConfigChange(func(fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(reloadDebounce, onChange)
+	})
+	v.WatchConfig()
+	return nil
+}
+
+// AnimeDiff lists the display names of the anime entries that differ between
+// two configs.
+type AnimeDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports whether both lists hold the same entries.
+func (d AnimeDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffAnimes compares two anime lists, matching entries by DisplayName.
+func DiffAnimes(old, new []AnimeConfig) AnimeDiff {
+	var diff AnimeDiff
+	oldByName := make(map[string]AnimeConfig, len(old))
+	for _, animeCfg := range old {
+		oldByName[animeCfg.DisplayName()] = animeCfg
+	}
+	newNames := make(map[string]bool, len(new))
+	for _, animeCfg := range new {
+		name := animeCfg.DisplayName()
+		newNames[name] = true
+		previous, ok := oldByName[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case !reflect.DeepEqual(previous, animeCfg):
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for _, animeCfg := range old {
+		if name := animeCfg.DisplayName(); !newNames[name] {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	return diff
+}
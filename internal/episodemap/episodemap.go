@@ -0,0 +1,151 @@
+package episodemap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"kotei/internal/config"
+	"kotei/internal/util"
+)
+
+type segment struct {
+	fromStart, fromEnd int
+	toStart            int
+}
+
+// Mapper translates AnimeFillerList episode numbers into Sonarr absolute
+// episode numbers. Numbers inside an explicit range segment are mapped by that
+// segment; all others are shifted by the constant offset.
+type Mapper struct {
+	offset   int
+	segments []segment
+}
+
+// New builds a Mapper from an anime entry's episode_mapping, rejecting
+// malformed or overlapping ranges and offsets that shift an episode onto a
+// Sonarr range.
+func New(mapping config.EpisodeMapping) (*Mapper, error) {
+	m := &Mapper{offset: mapping.Offset}
+	var sonarrRanges []segment
+	for i, r := range mapping.Ranges {
+		fromStart, fromEnd, err := parseMappingRange(r.FillerList)
+		if err != nil {
+			return nil, fmt.Errorf("episode_mapping.ranges[%d].fillerlist: %w", i, err)
+		}
+		toStart, toEnd, err := parseMappingRange(r.Sonarr)
+		if err != nil {
+			return nil, fmt.Errorf("episode_mapping.ranges[%d].sonarr: %w", i, err)
+		}
+		if fromEnd-fromStart != toEnd-toStart {
+			return nil, fmt.Errorf("episode_mapping.ranges[%d]: fillerlist range '%s' and sonarr range '%s' differ in length", i, r.FillerList, r.Sonarr)
+		}
+		m.segments = append(m.segments, segment{fromStart: fromStart, fromEnd: fromEnd, toStart: toStart})
+		sonarrRanges = append(sonarrRanges, segment{fromStart: toStart, fromEnd: toEnd})
+	}
+
+	if err := checkOverlap(m.segments, "fillerlist"); err != nil {
+		return nil, err
+	}
+	if err := checkOverlap(sonarrRanges, "sonarr"); err != nil {
+		return nil, err
+	}
+	sort.Slice(m.segments, func(i, j int) bool { return m.segments[i].fromStart < m.segments[j].fromStart })
+	if err := m.checkOffsetTargets(sonarrRanges); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// checkOffsetTargets rejects a mapping in which an episode outside every
+// fillerlist range is shifted by the offset into a sonarr range, as it and
+// the range's own episode would both map to the same Sonarr number.
+func (m *Mapper) checkOffsetTargets(sonarrRanges []segment) error {
+	for _, target := range sonarrRanges {
+		for episode := util.Max(target.fromStart-m.offset, 1); episode <= target.fromEnd-m.offset; episode++ {
+			if _, ok := m.segmentOf(episode); !ok {
+				return fmt.Errorf("episode_mapping: offset %d maps fillerlist episode %d to %d, inside sonarr range %d-%d; add a range for it or change the offset",
+					m.offset, episode, episode+m.offset, target.fromStart, target.fromEnd)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Mapper) segmentOf(episode int) (segment, bool) {
+	for _, s := range m.segments {
+		if episode >= s.fromStart && episode <= s.fromEnd {
+			return s, true
+		}
+	}
+	return segment{}, false
+}
+
+func parseMappingRange(text string) (int, int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, 0, fmt.Errorf("range is empty")
+	}
+	parts := strings.Split(text, "-")
+	if len(parts) == 1 {
+		n := util.AtoiSimple(parts[0])
+		if n <= 0 {
+			return 0, 0, fmt.Errorf("invalid episode '%s'", text)
+		}
+		return n, n, nil
+	}
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range '%s'", text)
+	}
+	start, end := util.AtoiSimple(parts[0]), util.AtoiSimple(parts[1])
+	if start <= 0 || end < start {
+		return 0, 0, fmt.Errorf("invalid range '%s'", text)
+	}
+	return start, end, nil
+}
+
+func checkOverlap(ranges []segment, side string) error {
+	sorted := append([]segment(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].fromStart < sorted[j].fromStart })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].fromStart <= sorted[i-1].fromEnd {
+			return fmt.Errorf("episode_mapping: %s ranges %d-%d and %d-%d overlap", side,
+				sorted[i-1].fromStart, sorted[i-1].fromEnd, sorted[i].fromStart, sorted[i].fromEnd)
+		}
+	}
+	return nil
+}
+
+// Map returns the Sonarr absolute number for an AnimeFillerList episode, or
+// false when the result would not be a valid episode number.
+func (m *Mapper) Map(episode int) (int, bool) {
+	mapped := episode + m.offset
+	if s, ok := m.segmentOf(episode); ok {
+		mapped = s.toStart + (episode - s.fromStart)
+	}
+	if mapped <= 0 {
+		return 0, false
+	}
+	return mapped, true
+}
+
+// MapAll maps every episode, dropping those without a valid target. The second
+// return value lists the AnimeFillerList numbers that were dropped.
+func (m *Mapper) MapAll(episodes []int) ([]int, []int) {
+	mapped := make([]int, 0, len(episodes))
+	var dropped []int
+	seen := make(map[int]bool, len(episodes))
+	for _, ep := range episodes {
+		target, ok := m.Map(ep)
+		if !ok {
+			dropped = append(dropped, ep)
+			continue
+		}
+		if !seen[target] {
+			seen[target] = true
+			mapped = append(mapped, target)
+		}
+	}
+	sort.Ints(mapped)
+	return mapped, dropped
+}
@@ -0,0 +1,158 @@
+package episodemap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"kotei/internal/config"
+)
+
+func ranges(pairs ...string) []config.EpisodeMappingRange {
+	var out []config.EpisodeMappingRange
+	for i := 0; i+1 < len(pairs); i += 2 {
+		out = append(out, config.EpisodeMappingRange{FillerList: pairs[i], Sonarr: pairs[i+1]})
+	}
+	return out
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping config.EpisodeMapping
+		wantErr string
+	}{
+		{name: "empty", mapping: config.EpisodeMapping{}},
+		{name: "offset only", mapping: config.EpisodeMapping{Offset: -2}},
+		{name: "single episodes", mapping: config.EpisodeMapping{Ranges: ranges("5", "7", "7", "5")}},
+		{
+			name:    "documented example",
+			mapping: config.EpisodeMapping{Offset: 1, Ranges: ranges("1-100", "1-100", "101-150", "102-151")},
+		},
+		{name: "empty range", mapping: config.EpisodeMapping{Ranges: ranges("", "1-2")}, wantErr: "ranges[0].fillerlist: range is empty"},
+		{name: "invalid episode", mapping: config.EpisodeMapping{Ranges: ranges("1-2", "x")}, wantErr: "ranges[0].sonarr: invalid episode 'x'"},
+		{name: "reversed range", mapping: config.EpisodeMapping{Ranges: ranges("5-1", "1-5")}, wantErr: "invalid range '5-1'"},
+		{name: "three parts", mapping: config.EpisodeMapping{Ranges: ranges("1-2-3", "1-3")}, wantErr: "invalid range '1-2-3'"},
+		{name: "length mismatch", mapping: config.EpisodeMapping{Ranges: ranges("1-10", "1-9")}, wantErr: "differ in length"},
+		{
+			name:    "fillerlist overlap",
+			mapping: config.EpisodeMapping{Ranges: ranges("1-10", "1-10", "10-12", "20-22")},
+			wantErr: "fillerlist ranges 1-10 and 10-12 overlap",
+		},
+		{
+			name:    "sonarr overlap",
+			mapping: config.EpisodeMapping{Ranges: ranges("1-10", "1-10", "20-22", "8-10")},
+			wantErr: "sonarr ranges 1-10 and 8-10 overlap",
+		},
+		{
+			name:    "offset onto a range",
+			mapping: config.EpisodeMapping{Ranges: ranges("1-100", "1-100", "101-150", "102-151")},
+			wantErr: "offset 0 maps fillerlist episode 151 to 151, inside sonarr range 102-151",
+		},
+		{
+			name:    "negative offset onto a range",
+			mapping: config.EpisodeMapping{Offset: -5, Ranges: ranges("1-3", "1-3")},
+			wantErr: "offset -5 maps fillerlist episode 6 to 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.mapping)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("New() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("New() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping config.EpisodeMapping
+		want    map[int]int // AnimeFillerList number to Sonarr number, 0 when unmapped
+	}{
+		{
+			name: "identity",
+			want: map[int]int{1: 1, 500: 500},
+		},
+		{
+			name:    "offset",
+			mapping: config.EpisodeMapping{Offset: -2},
+			want:    map[int]int{1: 0, 2: 0, 3: 1, 100: 98},
+		},
+		{
+			name:    "documented example",
+			mapping: config.EpisodeMapping{Offset: 1, Ranges: ranges("1-100", "1-100", "101-150", "102-151")},
+			want:    map[int]int{1: 1, 100: 100, 101: 102, 150: 151, 151: 152, 200: 201},
+		},
+		{
+			name:    "swapped episodes",
+			mapping: config.EpisodeMapping{Ranges: ranges("5", "7", "7", "5")},
+			want:    map[int]int{4: 4, 5: 7, 6: 6, 7: 5, 8: 8},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(tt.mapping)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for episode, want := range tt.want {
+				got, ok := m.Map(episode)
+				if ok != (want != 0) || got != want {
+					t.Errorf("Map(%d) = %d, %t, want %d", episode, got, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMapAll(t *testing.T) {
+	tests := []struct {
+		name        string
+		mapping     config.EpisodeMapping
+		episodes    []int
+		wantMapped  []int
+		wantDropped []int
+	}{
+		{
+			name:       "sorted and unique",
+			episodes:   []int{3, 1, 2, 3},
+			wantMapped: []int{1, 2, 3},
+		},
+		{
+			name:        "drops invalid targets",
+			mapping:     config.EpisodeMapping{Offset: -2},
+			episodes:    []int{1, 2, 3, 4},
+			wantMapped:  []int{1, 2},
+			wantDropped: []int{1, 2},
+		},
+		{
+			name:       "documented example keeps every episode",
+			mapping:    config.EpisodeMapping{Offset: 1, Ranges: ranges("1-100", "1-100", "101-150", "102-151")},
+			episodes:   []int{100, 101, 150, 151, 152},
+			wantMapped: []int{100, 102, 151, 152, 153},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(tt.mapping)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			mapped, dropped := m.MapAll(tt.episodes)
+			if !reflect.DeepEqual(mapped, tt.wantMapped) {
+				t.Errorf("MapAll() mapped = %v, want %v", mapped, tt.wantMapped)
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("MapAll() dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
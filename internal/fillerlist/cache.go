@@ -0,0 +1,112 @@
+package fillerlist
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cache keeps the last good copy of every fetched show page on disk, keyed by
+// show slug, together with the validators needed for conditional requests.
+type Cache struct {
+	Dir string
+	TTL time.Duration
+}
+
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+type cacheEntry struct {
+	Meta cacheMeta
+	Body []byte
+}
+
+// NewCache returns a cache rooted at dir, creating it if needed. An empty dir
+// selects a "kotei/fillerlist" directory under the user cache directory.
+func NewCache(dir string, ttl time.Duration) (*Cache, error) {
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userCacheDir, "kotei", "fillerlist")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: dir, TTL: ttl}, nil
+}
+
+func cacheKey(slug string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(strings.TrimSpace(slug))
+}
+
+func (c *Cache) paths(slug string) (string, string) {
+	base := filepath.Join(c.Dir, cacheKey(slug))
+	return base + ".html", base + ".json"
+}
+
+func (c *Cache) isFresh(entry *cacheEntry) bool {
+	return c.TTL > 0 && time.Since(entry.Meta.FetchedAt) < c.TTL
+}
+
+func (c *Cache) load(slug string, logger *slog.Logger) *cacheEntry {
+	bodyPath, metaPath := c.paths(slug)
+	metaBytes, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(metaBytes, &entry.Meta); err != nil {
+		logger.Warn("Ignoring unreadable cache metadata", "path", metaPath, "error", err)
+		return nil
+	}
+	if entry.Body, err = os.ReadFile(bodyPath); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+func (c *Cache) store(slug string, body []byte, meta cacheMeta, logger *slog.Logger) {
+	bodyPath, _ := c.paths(slug)
+	if err := writeFileAtomic(bodyPath, body); err != nil {
+		logger.Warn("Failed to write cache", "path", bodyPath, "error", err)
+		return
+	}
+	c.storeMeta(slug, meta, logger)
+}
+
+func (c *Cache) storeMeta(slug string, meta cacheMeta, logger *slog.Logger) {
+	_, metaPath := c.paths(slug)
+	metaBytes, err := json.MarshalIndent(meta, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(metaPath, metaBytes)
+	}
+	if err != nil {
+		logger.Warn("Failed to write cache", "path", metaPath, "error", err)
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
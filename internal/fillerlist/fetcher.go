@@ -0,0 +1,158 @@
+package fillerlist
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kotei/internal/logging"
+	"kotei/internal/metrics"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// StatusError is an unexpected HTTP status from AnimeFillerList.
+type StatusError struct {
+	URL        string
+	Status     string
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("HTTP request failed with status %s for URL %s", e.Status, e.URL)
+}
+
+// isTransient reports whether a failed fetch may succeed later: network
+// errors and server errors are, while a 4xx such as a wrong show slug is not
+// and should not hide behind a stale cached page.
+func isTransient(err error) bool {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// Fetcher downloads show pages, reusing one HTTP client and, when a Cache is
+// set, serving and revalidating pages from disk.
+type Fetcher struct {
+	ShowURLFormat string
+	Cache         *Cache
+	httpClient    *http.Client
+}
+
+func NewFetcher(showURLFormat string, cache *Cache) *Fetcher {
+	if showURLFormat == "" {
+		showURLFormat = DefaultShowURLFormat
+	}
+	return &Fetcher{
+		ShowURLFormat: showURLFormat,
+		Cache:         cache,
+		httpClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// FetchShow downloads a show page and scrapes it, preferring the per-episode
+// table and falling back to the summary sections.
+func (f *Fetcher) FetchShow(ctx context.Context, animeTitle string, logger *slog.Logger) (*Show, error) {
+	logger = logging.OrDiscard(logger).With(logging.ComponentKey, "filler")
+	body, err := f.fetchShowPage(ctx, animeTitle, logger)
+	if err != nil {
+		return nil, err
+	}
+	doc, parseErr := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed parse HTML: %w", parseErr)
+	}
+	return scrapeShow(doc, animeTitle, logger)
+}
+
+func (f *Fetcher) fetchShowPage(ctx context.Context, animeTitle string, logger *slog.Logger) ([]byte, error) {
+	showURL := fmt.Sprintf(f.ShowURLFormat, animeTitle)
+
+	var cached *cacheEntry
+	if f.Cache != nil {
+		cached = f.Cache.load(animeTitle, logger)
+		if cached != nil && cached.Meta.URL == showURL && f.Cache.isFresh(cached) {
+			logger.Info("Using cached show page",
+				"show", animeTitle, "age", time.Since(cached.Meta.FetchedAt).Round(time.Second).String())
+			return cached.Body, nil
+		}
+		if cached != nil && cached.Meta.URL != showURL {
+			cached = nil
+		}
+	}
+
+	logger.Info("Fetching show page from AnimeFillerList", "show", animeTitle)
+
+	body, meta, notModified, err := f.get(ctx, showURL, cached)
+	if err != nil {
+		if cached != nil && ctx.Err() == nil && isTransient(err) {
+			// Logged even on quiet runs: stale data should not go unnoticed.
+			slog.Default().Warn("Using stale cached show page",
+				logging.ComponentKey, "filler", "show", animeTitle,
+				"fetched_at", cached.Meta.FetchedAt.Format("2006-01-02 15:04"), "error", err)
+			return cached.Body, nil
+		}
+		return nil, err
+	}
+	if notModified {
+		cached.Meta.FetchedAt = time.Now()
+		f.Cache.storeMeta(animeTitle, cached.Meta, logger)
+		logger.Info("Not modified since last fetch, using cached copy", "show", animeTitle)
+		return cached.Body, nil
+	}
+	if f.Cache != nil {
+		f.Cache.store(animeTitle, body, meta, logger)
+	}
+	return body, nil
+}
+
+func (f *Fetcher) get(ctx context.Context, showURL string, cached *cacheEntry) ([]byte, cacheMeta, bool, error) {
+	meta := cacheMeta{URL: showURL}
+	req, httpErr := http.NewRequestWithContext(ctx, http.MethodGet, showURL, nil)
+	if httpErr != nil {
+		return nil, meta, false, fmt.Errorf("failed create request: %w", httpErr)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if cached != nil {
+		if cached.Meta.ETag != "" {
+			req.Header.Set("If-None-Match", cached.Meta.ETag)
+		}
+		if cached.Meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.Meta.LastModified)
+		}
+	}
+
+	requestStart := time.Now()
+	res, httpErr := f.httpClient.Do(req)
+	if httpErr != nil {
+		metrics.FillerListFetch("error", time.Since(requestStart))
+		return nil, meta, false, fmt.Errorf("failed GET URL %s: %w", showURL, httpErr)
+	}
+	defer res.Body.Close()
+	metrics.FillerListFetch(strconv.Itoa(res.StatusCode), time.Since(requestStart))
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		return nil, meta, true, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, meta, false, StatusError{URL: showURL, Status: res.Status, StatusCode: res.StatusCode}
+	}
+	body, readErr := io.ReadAll(res.Body)
+	if readErr != nil {
+		return nil, meta, false, fmt.Errorf("failed reading body of %s: %w", showURL, readErr)
+	}
+
+	meta.ETag = res.Header.Get("ETag")
+	meta.LastModified = res.Header.Get("Last-Modified")
+	meta.FetchedAt = time.Now()
+	return body, meta, false, nil
+}
@@ -0,0 +1,65 @@
+package fillerlist
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kotei/internal/logging"
+)
+
+func TestFetchShowPageStaleCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		down      bool // the server is unreachable
+		canceled  bool
+		wantStale bool
+	}{
+		{name: "server error", status: http.StatusServiceUnavailable, wantStale: true},
+		{name: "network error", down: true, wantStale: true},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "forbidden", status: http.StatusForbidden},
+		{name: "canceled", status: http.StatusOK, canceled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			if tt.down {
+				server.Close()
+			}
+
+			cache, err := NewCache(t.TempDir(), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fetcher := NewFetcher(server.URL+"/shows/%s", cache)
+			// A day old, past the TTL, so the page is fetched again.
+			cache.store("one-piece", []byte("cached"), cacheMeta{
+				URL:       server.URL + "/shows/one-piece",
+				FetchedAt: time.Now().Add(-24 * time.Hour),
+			}, logging.Discard())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.canceled {
+				cancel()
+			}
+			defer cancel()
+			body, err := fetcher.fetchShowPage(ctx, "one-piece", logging.Discard())
+			if tt.wantStale {
+				if err != nil || string(body) != "cached" {
+					t.Fatalf("fetchShowPage() = %q, %v; want the stale cached page", body, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("fetchShowPage() = %q, want an error", body)
+			}
+		})
+	}
+}
@@ -2,19 +2,39 @@ package fillerlist
 
 import (
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
-	"kotei/internal/util"
+	"kotei/internal/logging"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
-var NilLogger = log.New(io.Discard, "", 0)
+var NilLogger = logging.Discard()
+
+type EpisodeType string
+
+const (
+	TypeManga  EpisodeType = "manga"
+	TypeMixed  EpisodeType = "mixed"
+	TypeAnime  EpisodeType = "anime"
+	TypeFiller EpisodeType = "filler"
+)
+
+// Episode is a single row of the AnimeFillerList episode table.
+type Episode struct {
+	Number  int
+	Title   string
+	Type    EpisodeType
+	AirDate time.Time
+}
+
+const (
+	DefaultShowURLFormat = "https://www.animefillerlist.com/shows/%s/"
+	airDateLayout        = "2006-01-02"
+)
 
 func atoiSimple(s string) int { i, _ := strconv.Atoi(strings.TrimSpace(s)); return i }
 
@@ -41,17 +61,17 @@ func parseSingleEpisode(text string) int {
 	return 0
 }
 
-func scrapeEpisodesFromSection(doc *goquery.Document, sectionSelector string, logger *log.Logger) ([]int, error) {
-	if logger == nil {
-		logger = NilLogger
-	}
+// ParseEpisodeTokens expands episode tokens such as "12" or "15-20" into
+// de-duplicated episode numbers, in the order they were given. Tokens that
+// cannot be parsed are returned as warnings rather than failing the whole list.
+func ParseEpisodeTokens(tokens []string) ([]int, []string) {
 	var episodes []int
 	var parseErrors []string
 
-	doc.Find(sectionSelector).Each(func(i int, s *goquery.Selection) {
-		text := strings.TrimSpace(s.Text())
+	for _, token := range tokens {
+		text := strings.TrimSpace(token)
 		if text == "" {
-			return
+			continue
 		}
 		if strings.Contains(text, "-") {
 			parts := strings.Split(text, "-")
@@ -71,10 +91,6 @@ func scrapeEpisodesFromSection(doc *goquery.Document, sectionSelector string, lo
 				parseErrors = append(parseErrors, fmt.Sprintf("single '%s'", text))
 			}
 		}
-	})
-
-	if len(parseErrors) > 0 {
-		log.Printf("  %s Parse warnings for selector '%s': %v", util.Yellow("[FILLER]"), sectionSelector, parseErrors)
 	}
 
 	uniqueEpisodesMap := make(map[int]struct{})
@@ -85,104 +101,143 @@ func scrapeEpisodesFromSection(doc *goquery.Document, sectionSelector string, lo
 			uniqueEpisodesList = append(uniqueEpisodesList, ep)
 		}
 	}
-	return uniqueEpisodesList, nil
+	return uniqueEpisodesList, parseErrors
 }
 
-func GetCategorizedCanonEpisodes(animeTitle string, includeTypesFromConfig []string, logger *log.Logger) (mangaEps, animeEps, mixedEps []int, err error) {
+func scrapeEpisodesFromSection(doc *goquery.Document, sectionSelector string, logger *slog.Logger) ([]int, error) {
 	if logger == nil {
 		logger = NilLogger
 	}
+	var tokens []string
+	doc.Find(sectionSelector).Each(func(i int, s *goquery.Selection) {
+		tokens = append(tokens, s.Text())
+	})
 
-	baseURL := fmt.Sprintf("https://www.animefillerlist.com/shows/%s/", animeTitle)
-	requestedTypesMap := make(map[string]bool)
-	if len(includeTypesFromConfig) == 0 {
-		requestedTypesMap["manga"] = true
-		requestedTypesMap["mixed"] = true
-		requestedTypesMap["anime"] = true
-	} else {
-		for _, t := range includeTypesFromConfig {
-			typeName := strings.ToLower(strings.TrimSpace(t))
-			if typeName == "manga" || typeName == "mixed" || typeName == "anime" {
-				requestedTypesMap[typeName] = true
-			}
-		}
+	episodes, parseErrors := ParseEpisodeTokens(tokens)
+	if len(parseErrors) > 0 {
+		logger.Warn("Parse warnings in summary section", "selector", sectionSelector, "unparsed", parseErrors)
 	}
+	return episodes, nil
+}
+
+// Show is everything scraped from a single AnimeFillerList show page.
+// Episodes is only populated when the per-episode table was available;
+// Categories is always populated and, without the table, lacks filler.
+type Show struct {
+	Slug       string
+	Episodes   []Episode
+	Categories map[EpisodeType][]int
+}
 
-	if len(requestedTypesMap) == 0 {
-		logger.Printf("  %s No valid types specified or found for '%s'. Defaulting to all for processing.", util.Yellow("[FILLER]"), animeTitle)
-		requestedTypesMap["manga"] = true
-		requestedTypesMap["mixed"] = true
-		requestedTypesMap["anime"] = true
+func scrapeShow(doc *goquery.Document, animeTitle string, logger *slog.Logger) (*Show, error) {
+	show := &Show{Slug: animeTitle}
+	show.Episodes = scrapeEpisodeTable(doc, logger)
+	if len(show.Episodes) > 0 {
+		show.Categories = groupEpisodesByType(show.Episodes)
+		logCategoryCounts(show.Categories, true, logger)
+		return show, nil
+	}
+
+	logger.Warn("Episode table not found, falling back to summary sections", "show", animeTitle)
+	sectionSelectors := []struct {
+		epType   EpisodeType
+		selector string
+	}{
+		{TypeManga, "div.manga_canon span.Episodes a"},
+		{TypeMixed, "div.mixed_canon\\/filler span.Episodes a"},
+		{TypeAnime, "div.anime_canon span.Episodes a"},
+	}
+	show.Categories = make(map[EpisodeType][]int)
+	for _, section := range sectionSelectors {
+		eps, scrapeErr := scrapeEpisodesFromSection(doc, section.selector, logger)
+		if scrapeErr != nil {
+			logger.Warn("Error scraping summary section", "type", string(section.epType), "error", scrapeErr)
+			continue
+		}
+		show.Categories[section.epType] = eps
 	}
+	logCategoryCounts(show.Categories, false, logger)
+	return show, nil
+}
 
-	logger.Printf("  %s Fetching %s from %s...",
-		util.Purple("[FILLER]"),
-		util.Red(fmt.Sprintf("'%s'", animeTitle)),
-		util.Yellow("AnimeFillerList"))
+func parseEpisodeType(text string) EpisodeType {
+	t := strings.ToLower(strings.TrimSpace(text))
+	switch {
+	case strings.Contains(t, "mixed"):
+		return TypeMixed
+	case strings.Contains(t, "manga"):
+		return TypeManga
+	case strings.Contains(t, "anime canon"):
+		return TypeAnime
+	case strings.Contains(t, "filler"):
+		return TypeFiller
+	}
+	return ""
+}
 
-	httpClient := &http.Client{Timeout: 15 * time.Second}
-	req, httpErr := http.NewRequest("GET", baseURL, nil)
-	if httpErr != nil {
-		err = fmt.Errorf("failed create request: %w", httpErr)
-		return
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	res, httpErr := httpClient.Do(req)
-	if httpErr != nil {
-		err = fmt.Errorf("failed GET URL %s: %w", baseURL, httpErr)
-		return
-	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		err = fmt.Errorf("HTTP request failed with status %s for URL %s", res.Status, baseURL)
-		return
-	}
-	doc, parseErr := goquery.NewDocumentFromReader(res.Body)
-	if parseErr != nil {
-		err = fmt.Errorf("failed parse HTML: %w", parseErr)
-		return
+func scrapeEpisodeTable(doc *goquery.Document, logger *slog.Logger) []Episode {
+	if logger == nil {
+		logger = NilLogger
 	}
+	var episodes []Episode
+	var parseErrors []string
+	seen := make(map[int]struct{})
+
+	doc.Find("table.EpisodeList tbody tr").Each(func(i int, row *goquery.Selection) {
+		numberText := strings.TrimSpace(row.Find("td.Number").Text())
+		number := parseSingleEpisode(numberText)
+		if number == 0 {
+			if numberText != "" {
+				parseErrors = append(parseErrors, fmt.Sprintf("number '%s'", numberText))
+			}
+			return
+		}
+		if _, exists := seen[number]; exists {
+			return
+		}
 
-	mangaCanonSelector := "div.manga_canon span.Episodes a"
-	mixedCanonSelector := "div.mixed_canon\\/filler span.Episodes a"
-	animeCanonSelector := "div.anime_canon span.Episodes a"
-	var scrapeErr error
-
-	if requestedTypesMap["manga"] {
-		mangaEps, scrapeErr = scrapeEpisodesFromSection(doc, mangaCanonSelector, logger)
-		if scrapeErr != nil {
-			logger.Printf("  %s Error scraping manga: %v", util.Yellow("[FILLER]"), scrapeErr)
+		epType := parseEpisodeType(row.Find("td.Type").Text())
+		if epType == "" {
+			parseErrors = append(parseErrors, fmt.Sprintf("type for episode %d", number))
+			return
 		}
-	}
-	if requestedTypesMap["mixed"] {
-		mixedEps, scrapeErr = scrapeEpisodesFromSection(doc, mixedCanonSelector, logger)
-		if scrapeErr != nil {
-			logger.Printf("  %s Error scraping mixed: %v", util.Yellow("[FILLER]"), scrapeErr)
+
+		ep := Episode{
+			Number: number,
+			Title:  strings.TrimSpace(row.Find("td.Title").Text()),
+			Type:   epType,
 		}
-	}
-	if requestedTypesMap["anime"] {
-		animeEps, scrapeErr = scrapeEpisodesFromSection(doc, animeCanonSelector, logger)
-		if scrapeErr != nil {
-			logger.Printf("  %s Error scraping anime: %v", util.Yellow("[FILLER]"), scrapeErr)
+		if dateText := strings.TrimSpace(row.Find("td.Date").Text()); dateText != "" {
+			if airDate, err := time.Parse(airDateLayout, dateText); err == nil {
+				ep.AirDate = airDate
+			}
 		}
-	}
+		seen[number] = struct{}{}
+		episodes = append(episodes, ep)
+	})
 
-	var countsParts []string
-	if requestedTypesMap["manga"] {
-		countsParts = append(countsParts, fmt.Sprintf("Manga: %d", len(mangaEps)))
-	}
-	if requestedTypesMap["mixed"] {
-		countsParts = append(countsParts, fmt.Sprintf("Mixed: %d", len(mixedEps)))
-	}
-	if requestedTypesMap["anime"] {
-		countsParts = append(countsParts, fmt.Sprintf("Anime: %d", len(animeEps)))
+	if len(parseErrors) > 0 {
+		logger.Warn("Parse warnings in episode table", "unparsed", parseErrors)
 	}
+	return episodes
+}
 
-	countsString := "No types processed or counts available"
-	if len(countsParts) > 0 {
-		countsString = strings.Join(countsParts, ", ")
+func groupEpisodesByType(episodes []Episode) map[EpisodeType][]int {
+	byType := make(map[EpisodeType][]int)
+	for _, ep := range episodes {
+		byType[ep.Type] = append(byType[ep.Type], ep.Number)
 	}
-	logger.Printf("  %s Counts - %s.", util.Purple("[FILLER]"), countsString)
+	return byType
+}
 
-	return
+func logCategoryCounts(categories map[EpisodeType][]int, fillerKnown bool, logger *slog.Logger) {
+	counts := []any{
+		"manga", len(categories[TypeManga]),
+		"mixed", len(categories[TypeMixed]),
+		"anime", len(categories[TypeAnime]),
+	}
+	if fillerKnown {
+		counts = append(counts, "filler", len(categories[TypeFiller]))
+	}
+	logger.Info("Episode counts", counts...)
 }
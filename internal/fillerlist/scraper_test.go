@@ -0,0 +1,78 @@
+package fillerlist
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func loadFixture(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestScrapeShowTable(t *testing.T) {
+	show, err := scrapeShow(loadFixture(t, "table.html"), "naruto", NilLogger)
+	if err != nil {
+		t.Fatalf("scrapeShow() error = %v", err)
+	}
+	date := func(s string) time.Time {
+		d, _ := time.Parse(airDateLayout, s)
+		return d
+	}
+	wantEpisodes := []Episode{
+		{Number: 1, Title: "Enter: Naruto Uzumaki!", Type: TypeManga, AirDate: date("2002-10-03")},
+		{Number: 2, Title: "My Name is Konohamaru!", Type: TypeManga, AirDate: date("2002-10-10")},
+		{Number: 3, Title: "Sasuke and Sakura: Friends or Foes?", Type: TypeMixed, AirDate: date("2002-10-17")},
+		{Number: 4, Title: "Pass or Fail: Survival Test", Type: TypeFiller, AirDate: date("2002-10-24")},
+		{Number: 5, Title: "You Failed! Kakashi's Final Decision", Type: TypeManga},
+		{Number: 6, Title: "A Dangerous Mission!", Type: TypeAnime, AirDate: date("2002-11-07")},
+		// An unparsable date is left zero; the duplicate row, the unknown
+		// type and the non-numeric episode are skipped.
+		{Number: 7, Title: "The Assassin of the Mist!", Type: TypeFiller},
+	}
+	if !reflect.DeepEqual(show.Episodes, wantEpisodes) {
+		t.Errorf("Episodes =\n%+v\nwant\n%+v", show.Episodes, wantEpisodes)
+	}
+	wantCategories := map[EpisodeType][]int{
+		TypeManga:  {1, 2, 5},
+		TypeMixed:  {3},
+		TypeAnime:  {6},
+		TypeFiller: {4, 7},
+	}
+	if !reflect.DeepEqual(show.Categories, wantCategories) {
+		t.Errorf("Categories = %v, want %v", show.Categories, wantCategories)
+	}
+}
+
+func TestScrapeShowSummary(t *testing.T) {
+	show, err := scrapeShow(loadFixture(t, "summary.html"), "naruto", NilLogger)
+	if err != nil {
+		t.Fatalf("scrapeShow() error = %v", err)
+	}
+	if len(show.Episodes) != 0 {
+		t.Errorf("Episodes = %+v, want none without the table", show.Episodes)
+	}
+	// The summary sections do not list filler; "x-y" is skipped.
+	wantCategories := map[EpisodeType][]int{
+		TypeManga: {1, 2, 5, 9, 10, 11},
+		TypeMixed: {3},
+		TypeAnime: {6},
+	}
+	if !reflect.DeepEqual(show.Categories, wantCategories) {
+		t.Errorf("Categories = %v, want %v", show.Categories, wantCategories)
+	}
+}
@@ -0,0 +1,282 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"kotei/internal/util"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+
+	// ComponentKey tags a record with the subsystem that logged it, such as
+	// "sonarr" or "filler". The text handler renders it as a "[SONARR]" prefix.
+	ComponentKey = "component"
+
+	// HeadingKey marks a record that starts a new section of console output,
+	// such as the start of an anime entry. See Heading.
+	HeadingKey = "heading"
+)
+
+// Options configures New.
+type Options struct {
+	Format string
+	Level  string
+}
+
+// ParseLevel maps a config level name to a slog.Level.
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level '%s' (expected debug, info, warn or error)", level)
+}
+
+// ColorEnabled reports whether w is a terminal and NO_COLOR is not set.
+func ColorEnabled(w io.Writer) bool {
+	if _, set := os.LookupEnv("NO_COLOR"); set || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && (isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()))
+}
+
+// New builds the application logger. The JSON format never contains color
+// codes; the text format is colored only when w is a terminal.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(strings.TrimSpace(opts.Format)) {
+	case "", FormatText:
+		colored := ColorEnabled(w)
+		color.NoColor = !colored
+		return slog.New(NewTextHandler(w, level, colored)), nil
+	case FormatJSON:
+		color.NoColor = true
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})), nil
+	}
+	return nil, fmt.Errorf("unknown log format '%s' (expected %s or %s)", opts.Format, FormatText, FormatJSON)
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 100}))
+}
+
+// OrDiscard returns logger, or a discarding logger when it is nil.
+func OrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return Discard()
+	}
+	return logger
+}
+
+// AtLeast returns a logger that drops records of logger below level, for
+// libraries that are too chatty at lower levels.
+func AtLeast(logger *slog.Logger, level slog.Level) *slog.Logger {
+	return slog.New(minLevelHandler{Handler: OrDiscard(logger).Handler(), level: level})
+}
+
+type minLevelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h minLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h minLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return minLevelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h minLevelHandler) WithGroup(name string) slog.Handler {
+	return minLevelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// Heading logs msg at info level as the start of a new console section. The
+// text handler separates it from the previous output with a blank line.
+func Heading(logger *slog.Logger, msg string, args ...any) {
+	logger.Info(msg, append([]any{slog.Bool(HeadingKey, true)}, args...)...)
+}
+
+// TextHandler renders records for people reading the console: a colored
+// component tag, the message, and the attributes of the record and of
+// Logger.With, such as run_id or anime. Groups prefix the keys, as in
+// "group.key". Records scoped to an anime entry or a component are indented
+// below their heading.
+type TextHandler struct {
+	mu        *sync.Mutex
+	w         io.Writer
+	level     slog.Leveler
+	colored   bool
+	component string
+	nested    bool
+	// group is the key prefix of WithGroup, and attrs the formatted
+	// attributes of WithAttrs.
+	group string
+	attrs []string
+}
+
+func NewTextHandler(w io.Writer, level slog.Leveler, colored bool) *TextHandler {
+	return &TextHandler{mu: &sync.Mutex{}, w: w, level: level, colored: colored}
+}
+
+func (h *TextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *TextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	clone.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		if h.group == "" {
+			switch a.Key {
+			case ComponentKey:
+				clone.component = a.Value.String()
+				continue
+			case "anime":
+				clone.nested = true
+			}
+		}
+		clone.attrs = h.appendAttr(clone.attrs, h.group, a)
+	}
+	return &clone
+}
+
+func (h *TextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.group = h.group + name + "."
+	return &clone
+}
+
+// appendAttr formats a as key=value, flattening groups into prefixed keys.
+func (h *TextHandler) appendAttr(out []string, prefix string, a slog.Attr) []string {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return out
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, member := range a.Value.Group() {
+			out = h.appendAttr(out, prefix, member)
+		}
+		return out
+	}
+	return append(out, h.paint(util.Gray, prefix+a.Key+"=")+formatValue(a.Value))
+}
+
+func (h *TextHandler) paint(fn func(a ...interface{}) string, s string) string {
+	if !h.colored {
+		return s
+	}
+	return fn(s)
+}
+
+func (h *TextHandler) Handle(_ context.Context, r slog.Record) error {
+	component := h.component
+	heading := false
+	attrs := slices.Clip(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		if h.group == "" {
+			switch a.Key {
+			case ComponentKey:
+				component = a.Value.String()
+				return true
+			case HeadingKey:
+				heading = a.Value.Bool()
+				return true
+			}
+		}
+		attrs = h.appendAttr(attrs, h.group, a)
+		return true
+	})
+
+	indent := ""
+	if h.nested || component != "" {
+		indent = "  "
+	}
+	var b strings.Builder
+	if heading {
+		b.WriteString("\n" + indent + h.paint(util.BlueBold, r.Message))
+		if len(attrs) > 0 {
+			b.WriteString(" " + strings.Join(attrs, " "))
+		}
+		b.WriteString("\n")
+		return h.write(b.String())
+	}
+	b.WriteString(indent)
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString(h.paint(util.RedBold, "!!! ERROR") + " ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString(h.paint(util.Yellow, "[WARN]") + " ")
+	}
+	if component != "" {
+		tag := "[" + strings.ToUpper(component) + "]"
+		b.WriteString(h.paint(componentColor(component), tag) + " ")
+	}
+	b.WriteString(r.Message)
+	if len(attrs) > 0 {
+		b.WriteString(" " + strings.Join(attrs, " "))
+	}
+	b.WriteString("\n")
+	return h.write(b.String())
+}
+
+func (h *TextHandler) write(line string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, line)
+	return err
+}
+
+func formatValue(v slog.Value) string {
+	s := v.Resolve().String()
+	if strings.ContainsAny(s, " \t\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+func componentColor(component string) func(a ...interface{}) string {
+	switch strings.ToLower(component) {
+	case "sonarr":
+		return util.Cyan
+	case "filler", "mapping":
+		return util.Purple
+	case "schedule":
+		return util.YellowBold
+	case "processor":
+		return util.Green
+	}
+	return util.Blue
+}
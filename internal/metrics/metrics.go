@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "kotei"
+
+// Registry holds every Kotei metric plus the Go and process collectors. It is
+// served by Handler.
+var Registry = prometheus.NewRegistry()
+
+var (
+	runsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_total",
+		Help:      "Finished runs by trigger and result (success, partial or failed).",
+	}, []string{"trigger", "result"})
+
+	runDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "run_duration_seconds",
+		Help:      "Duration of finished runs.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200},
+	}, []string{"trigger"})
+
+	lastRunTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Unix time the last run with the given result finished.",
+	}, []string{"result"})
+
+	lastRunAnimes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_animes",
+		Help:      "Anime entries in the last run by status, as in the [Run Stats] line.",
+	}, []string{"status"})
+
+	canonEpisodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "canon_episodes",
+		Help:      "Episodes on the canon list of an anime entry by type, as of its last fetch.",
+	}, []string{"anime", "type"})
+
+	episodesChanged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "episodes_total",
+		Help:      "Episodes changed in Sonarr by action (monitor, unmonitor or search). Dry runs are not counted.",
+	}, []string{"anime", "action"})
+
+	seriesNotFound = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "series_not_found_total",
+		Help:      "Anime entries skipped because their series was not found in Sonarr.",
+	}, []string{"anime"})
+
+	fillerListFetchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fillerlist_fetch_duration_seconds",
+		Help:      "Latency of AnimeFillerList page requests, excluding cache hits.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	fillerListResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fillerlist_responses_total",
+		Help:      "AnimeFillerList responses by HTTP status code, or \"error\" when no response was received.",
+	}, []string{"code"})
+
+	sonarrAPIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sonarr_api_errors_total",
+		Help:      "Failed Sonarr API calls by method, endpoint and HTTP status code, or \"error\" when no response was received.",
+	}, []string{"method", "endpoint", "code"})
+
+	notificationsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Run notifications by target and result (ok or error).",
+	}, []string{"target", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		runsTotal, runDuration, lastRunTimestamp, lastRunAnimes,
+		canonEpisodes, episodesChanged, seriesNotFound,
+		fillerListFetchDuration, fillerListResponses, sonarrAPIErrors,
+		notificationsSent,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RunFinished records a finished run and the per-status anime counts of its
+// [Run Stats] line.
+func RunFinished(trigger, result string, duration time.Duration, ok, skipped, failed int) {
+	runsTotal.WithLabelValues(trigger, result).Inc()
+	runDuration.WithLabelValues(trigger).Observe(duration.Seconds())
+	lastRunTimestamp.WithLabelValues(result).SetToCurrentTime()
+	lastRunAnimes.WithLabelValues("ok").Set(float64(ok))
+	lastRunAnimes.WithLabelValues("skipped").Set(float64(skipped))
+	lastRunAnimes.WithLabelValues("failed").Set(float64(failed))
+}
+
+// CanonEpisodes records the size of one category of an anime's canon list.
+func CanonEpisodes(anime, episodeType string, count int) {
+	canonEpisodes.WithLabelValues(anime, episodeType).Set(float64(count))
+}
+
+// EpisodesChanged counts episodes monitored, unmonitored or searched in Sonarr.
+func EpisodesChanged(anime, action string, count int) {
+	episodesChanged.WithLabelValues(anime, action).Add(float64(count))
+}
+
+// SeriesNotFound counts an anime entry skipped for a missing Sonarr series.
+func SeriesNotFound(anime string) {
+	seriesNotFound.WithLabelValues(anime).Inc()
+}
+
+// FillerListFetch records one AnimeFillerList request. code is the HTTP status
+// code as text, or "error".
+func FillerListFetch(code string, duration time.Duration) {
+	fillerListFetchDuration.Observe(duration.Seconds())
+	fillerListResponses.WithLabelValues(code).Inc()
+}
+
+// SonarrAPIError counts a failed Sonarr API call. code is the HTTP status code
+// as text, or "error".
+func SonarrAPIError(method, endpoint, code string) {
+	sonarrAPIErrors.WithLabelValues(method, endpoint, code).Inc()
+}
+
+// NotificationSent counts a run sent to a notification target. result is
+// "ok" or "error".
+func NotificationSent(target, result string) {
+	notificationsSent.WithLabelValues(target, result).Inc()
+}
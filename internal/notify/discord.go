@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"kotei/internal/config"
+	"kotei/internal/scheduler"
+)
+
+const chatTimeout = 10 * time.Second
+
+// discordMessageLimit is Discord's cap on the characters of all the embeds of
+// a message, counting titles, descriptions, footers and fields.
+const discordMessageLimit = 6000
+
+// discordMoreReserve keeps room in each embed for the field that counts the
+// entries left out.
+const discordMoreReserve = 80
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Footer      *discordFooter `json:"footer,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+// Discord posts a run summary as embeds to a Discord channel webhook: one in
+// the run's color with the changes and one in red with the problems.
+type Discord struct {
+	cfg        config.ChatConfig
+	httpClient *http.Client
+}
+
+func NewDiscord(cfg config.ChatConfig) *Discord {
+	return &Discord{cfg: cfg, httpClient: &http.Client{Timeout: chatTimeout}}
+}
+
+func (d *Discord) Name() string {
+	return "discord " + d.cfg.DisplayName()
+}
+
+func (d *Discord) Notify(ctx context.Context, stats scheduler.RunStats, _ []Event) error {
+	if isQuiet(stats) && !d.cfg.NotifyQuietRuns {
+		return nil
+	}
+	body, err := json.Marshal(discordPayload(summarize(stats)))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(d.httpClient, req)
+}
+
+func discordPayload(summary runSummary) discordMessage {
+	title := summary.Title
+	if summary.DryRun {
+		title = "[DRY RUN] " + title
+	}
+	description := summary.Counts
+	if len(summary.Changed) == 0 && len(summary.Problems) == 0 {
+		description += "\nAll quiet, nothing changed."
+	}
+	if summary.Omitted > 0 {
+		description += fmt.Sprintf("\n…and %d more anime entries not listed.", summary.Omitted)
+	}
+
+	main := discordEmbed{
+		Title:       truncate(title, 256),
+		Description: description,
+		Color:       summary.Color,
+		Footer:      &discordFooter{Text: summary.Footer},
+		Timestamp:   summary.Timestamp.UTC().Format(time.RFC3339),
+	}
+	problems := discordEmbed{Title: "Problems", Color: colorFailed}
+	remaining := discordMessageLimit - embedLength(main) - discordMoreReserve
+	if len(summary.Problems) > 0 {
+		remaining -= embedLength(problems) + discordMoreReserve
+	}
+
+	// Problems take the room first, as the summary keeps them over changes.
+	var problemFields []discordField
+	for _, line := range summary.Problems {
+		value := line.Error
+		if len(line.Lines) > 0 {
+			value = strings.Join(line.Lines, "\n") + "\n" + value
+		}
+		problemFields = append(problemFields, discordField{
+			Name:  truncate(line.Anime, 256),
+			Value: truncate(value, 1024),
+		})
+	}
+	problems.Fields = fitFields(problemFields, &remaining)
+
+	var changedFields []discordField
+	for _, line := range summary.Changed {
+		changedFields = append(changedFields, discordField{
+			Name:  truncate(line.Anime, 256),
+			Value: truncate(strings.Join(line.Lines, "\n"), 1024),
+		})
+	}
+	main.Fields = fitFields(changedFields, &remaining)
+
+	message := discordMessage{Username: "Kotei", Embeds: []discordEmbed{main}}
+	if len(summary.Problems) > 0 {
+		message.Embeds = append(message.Embeds, problems)
+	}
+	return message
+}
+
+// fitFields keeps the fields that fit in the remaining characters and
+// replaces the rest with a single "… N more" field, which the caller has
+// reserved room for.
+func fitFields(fields []discordField, remaining *int) []discordField {
+	var kept []discordField
+	for i, field := range fields {
+		size := utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+		if size > *remaining {
+			return append(kept, discordField{
+				Name:  fmt.Sprintf("… %d more", len(fields)-i),
+				Value: "Not listed, the message is at Discord's size limit.",
+			})
+		}
+		*remaining -= size
+		kept = append(kept, field)
+	}
+	return kept
+}
+
+// embedLength counts the characters of an embed the way Discord does.
+func embedLength(embed discordEmbed) int {
+	n := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	if embed.Footer != nil {
+		n += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	for _, field := range embed.Fields {
+		n += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	return n
+}
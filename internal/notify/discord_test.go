@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscordPayloadSizeLimit(t *testing.T) {
+	long := strings.Repeat("x", 2000)
+	tests := []struct {
+		name         string
+		changed      int
+		problems     int
+		wantFields   []int // fields per embed
+		wantMoreLast []string
+	}{
+		{name: "small", changed: 3, problems: 1, wantFields: []int{3, 1}, wantMoreLast: []string{"", ""}},
+		{name: "changes only", changed: 20, wantFields: []int{6}, wantMoreLast: []string{"… 15 more"}},
+		{name: "problems first", changed: 10, problems: 10, wantFields: []int{1, 6}, wantMoreLast: []string{"… 10 more", "… 5 more"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := runSummary{Title: "Kotei run succeeded", Counts: "counts", Footer: "run 1", Timestamp: time.Now()}
+			for i := range tt.changed {
+				lines := []string{"Monitored 1–10"}
+				if tt.name != "small" {
+					lines = append(lines, long)
+				}
+				summary.Changed = append(summary.Changed, animeLine{Anime: fmt.Sprintf("Anime %d", i), Lines: lines})
+			}
+			for i := range tt.problems {
+				summary.Problems = append(summary.Problems, animeLine{Anime: fmt.Sprintf("Broken %d", i), Error: long})
+			}
+
+			message := discordPayload(summary)
+			total := 0
+			for _, embed := range message.Embeds {
+				total += embedLength(embed)
+			}
+			if total > discordMessageLimit {
+				t.Errorf("message has %d characters, over %d", total, discordMessageLimit)
+			}
+			if len(message.Embeds) != len(tt.wantFields) {
+				t.Fatalf("embeds = %d, want %d", len(message.Embeds), len(tt.wantFields))
+			}
+			for i, embed := range message.Embeds {
+				if len(embed.Fields) != tt.wantFields[i] {
+					t.Errorf("embed %d has %d fields, want %d", i, len(embed.Fields), tt.wantFields[i])
+				}
+				last := embed.Fields[len(embed.Fields)-1].Name
+				if more := strings.HasPrefix(last, "… "); more != (tt.wantMoreLast[i] != "") || (more && last != tt.wantMoreLast[i]) {
+					t.Errorf("embed %d ends with field %q, want %q", i, last, tt.wantMoreLast[i])
+				}
+			}
+		})
+	}
+}
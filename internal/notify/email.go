@@ -0,0 +1,444 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"kotei/internal/config"
+	"kotei/internal/processor"
+	"kotei/internal/scheduler"
+)
+
+const defaultSMTPTimeout = 30 * time.Second
+
+// maxDigestRuns caps the runs queued for a digest, so a mail server that stays
+// unreachable does not grow the queue without limit. The oldest runs are
+// dropped first and counted in the next digest.
+const maxDigestRuns = 100
+
+// digestData is what the email templates are rendered with.
+type digestData struct {
+	Subject string
+	Runs    []digestRun
+	// Dropped counts older runs left out of the digest by maxDigestRuns.
+	Dropped int
+}
+
+type digestRun struct {
+	ID       string
+	Trigger  string
+	Finished string
+	Result   string
+	DryRun   bool
+	Counts   string
+	Animes   []digestAnime
+}
+
+type digestAnime struct {
+	Anime       string
+	Status      string
+	Error       string
+	Monitored   []digestEpisode
+	Unmonitored []digestEpisode
+	Searched    string
+}
+
+type digestEpisode struct {
+	Number int
+	Code   string
+	Title  string
+}
+
+func digestEpisodes(planned []processor.PlannedEpisode) []digestEpisode {
+	out := make([]digestEpisode, 0, len(planned))
+	for _, ep := range planned {
+		out = append(out, digestEpisode{
+			Number: ep.Number,
+			Code:   fmt.Sprintf("S%02dE%02d", ep.SeasonNumber, ep.EpisodeNumber),
+			Title:  ep.Title,
+		})
+	}
+	return out
+}
+
+func newDigestRun(stats scheduler.RunStats) digestRun {
+	run := digestRun{
+		ID:       stats.ID,
+		Trigger:  stats.Trigger,
+		Finished: stats.FinishedAt.Format("2006-01-02 15:04"),
+		Result:   stats.Result(),
+		DryRun:   stats.DryRun,
+		Counts: fmt.Sprintf("%d processed, %d ok, %d skipped, %d failed",
+			stats.Processed, stats.OK, stats.Skipped, stats.Failed),
+	}
+	for _, result := range stats.Animes {
+		anime := digestAnime{
+			Anime:       result.Anime,
+			Error:       result.Error,
+			Monitored:   digestEpisodes(result.Monitored),
+			Unmonitored: digestEpisodes(result.Unmonitored),
+		}
+		switch {
+		case result.Status == scheduler.AnimeStatusNotFound:
+			anime.Status = "skipped"
+		case result.Status == scheduler.AnimeStatusError:
+			anime.Status = "failed"
+		case result.ActionTaken:
+			anime.Status = "changed"
+		default:
+			anime.Status = "no changes"
+		}
+		if len(result.Searched) > 0 {
+			anime.Searched = fmt.Sprintf("%s (%s)", plural(len(result.Searched), "episode"), compactRanges(result.Searched))
+		}
+		run.Animes = append(run.Animes, anime)
+	}
+	return run
+}
+
+// digestSubject sums up the runs, e.g. "[Kotei] 4 episodes monitored, 1 failed".
+func digestSubject(runs []scheduler.RunStats) string {
+	monitored, searched, skipped, failed := 0, 0, 0, 0
+	dryRun := false
+	for _, stats := range runs {
+		for _, result := range stats.Animes {
+			monitored += len(result.Monitored)
+			searched += len(result.Searched)
+		}
+		skipped += stats.Skipped
+		failed += stats.Failed
+		dryRun = dryRun || stats.DryRun
+	}
+	var parts []string
+	if monitored > 0 {
+		parts = append(parts, plural(monitored, "episode")+" monitored")
+	}
+	if searched > 0 {
+		parts = append(parts, plural(searched, "episode")+" searched")
+	}
+	if skipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped", skipped))
+	}
+	if failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", failed))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "no changes")
+	}
+	subject := "[Kotei] " + strings.Join(parts, ", ")
+	if dryRun {
+		subject += " (dry run)"
+	}
+	return subject
+}
+
+var textDigest = template.Must(template.New("text").Parse(`{{ .Subject }}
+{{ if .Dropped }}
+{{ .Dropped }} older runs were dropped from this digest, it keeps the last {{ len .Runs }}.
+{{ end }}
+{{- range .Runs }}
+Run {{ .ID }} ({{ .Trigger }}) finished {{ .Finished }}: {{ .Result }}{{ if .DryRun }}, DRY RUN - nothing was changed{{ end }}
+{{ .Counts }}
+{{ range .Animes }}
+* {{ .Anime }}: {{ .Status }}
+{{- if .Error }}
+    Error: {{ .Error }}
+{{- end }}
+{{- if .Monitored }}
+    Newly monitored:
+{{- range .Monitored }}
+      #{{ .Number }} {{ .Code }} {{ .Title }}
+{{- end }}
+{{- end }}
+{{- if .Unmonitored }}
+    Unmonitored:
+{{- range .Unmonitored }}
+      #{{ .Number }} {{ .Code }} {{ .Title }}
+{{- end }}
+{{- end }}
+{{- if .Searched }}
+    Search queued for {{ .Searched }}
+{{- end }}
+{{ end }}
+{{- end }}`))
+
+var htmlDigest = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif; font-size: 14px; color: #222;">
+<h2 style="margin-bottom: 4px;">{{ .Subject }}</h2>
+{{ if .Dropped }}<p style="color: #e67e22;">{{ .Dropped }} older runs were dropped from this digest, it keeps the last {{ len .Runs }}.</p>{{ end }}
+{{ range .Runs }}
+<h3 style="margin-bottom: 2px;">Run {{ .ID }} &middot; {{ .Trigger }} &middot; {{ .Finished }} &middot; {{ .Result }}
+{{ if .DryRun }}<span style="background: #e67e22; color: #fff; padding: 1px 6px; border-radius: 3px; font-size: 12px;">DRY RUN</span>{{ end }}</h3>
+<p style="margin-top: 0; color: #666;">{{ .Counts }}</p>
+<table cellpadding="4" style="border-collapse: collapse;">
+{{ range .Animes }}
+<tr style="border-top: 1px solid #ddd;">
+<td style="vertical-align: top;"><strong>{{ .Anime }}</strong></td>
+<td style="vertical-align: top;">
+{{ if .Error }}<div style="color: #e74c3c;">{{ .Status }}: {{ .Error }}</div>{{ else }}<div>{{ .Status }}</div>{{ end }}
+{{ if .Monitored }}<div>Newly monitored:</div><ul style="margin: 2px 0;">{{ range .Monitored }}<li>#{{ .Number }} {{ .Code }} {{ .Title }}</li>{{ end }}</ul>{{ end }}
+{{ if .Unmonitored }}<div>Unmonitored:</div><ul style="margin: 2px 0;">{{ range .Unmonitored }}<li>#{{ .Number }} {{ .Code }} {{ .Title }}</li>{{ end }}</ul>{{ end }}
+{{ if .Searched }}<div>Search queued for {{ .Searched }}</div>{{ end }}
+</td>
+</tr>
+{{ end }}
+</table>
+{{ end }}
+</body></html>
+`))
+
+// DigestStore keeps the queue of a daily or weekly email digest, so it
+// survives restarts and collects runs of separate 'kotei run --once'
+// invocations. state.Store implements it.
+type DigestStore interface {
+	EmailDigest() (pending []scheduler.RunStats, dropped int, lastSent time.Time, err error)
+	SaveEmailDigest(pending []scheduler.RunStats, dropped int, lastSent time.Time) error
+}
+
+// Email sends an HTML and plain-text digest over SMTP, right after each run
+// with changes or problems, or collected into one daily or weekly message.
+type Email struct {
+	cfg     config.EmailConfig
+	timeout time.Duration
+	period  time.Duration
+
+	mu       sync.Mutex
+	store    DigestStore
+	pending  []scheduler.RunStats
+	dropped  int
+	lastSent time.Time
+}
+
+func NewEmail(cfg config.EmailConfig) *Email {
+	e := &Email{cfg: cfg, timeout: defaultSMTPTimeout}
+	if cfg.TimeoutSeconds > 0 {
+		e.timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	switch cfg.Digest {
+	case config.DigestDaily:
+		e.period = 24 * time.Hour
+	case config.DigestWeekly:
+		e.period = 7 * 24 * time.Hour
+	}
+	return e
+}
+
+func (e *Email) Name() string {
+	return "email " + e.cfg.Host
+}
+
+// SetStore keeps the digest queue in store rather than only in memory.
+func (e *Email) SetStore(store DigestStore) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.store = store
+}
+
+// Notify sends the run, or queues it for the next digest. A batched digest
+// goes out with the first run that finishes after its period has passed.
+// With a store the queue is loaded before and saved after each run; if it
+// cannot be loaded, the queue held in memory is used.
+func (e *Email) Notify(ctx context.Context, stats scheduler.RunStats, _ []Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var errs []error
+	if e.store != nil {
+		pending, dropped, lastSent, err := e.store.EmailDigest()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load the digest queue: %w", err))
+		} else {
+			e.pending, e.dropped, e.lastSent = pending, dropped, lastSent
+		}
+	}
+	if e.lastSent.IsZero() {
+		e.lastSent = time.Now()
+	}
+	if !isQuiet(stats) {
+		e.pending = append(e.pending, stats)
+		if extra := len(e.pending) - maxDigestRuns; extra > 0 {
+			e.pending = e.pending[extra:]
+			e.dropped += extra
+		}
+	}
+	if len(e.pending) > 0 && (e.period == 0 || time.Since(e.lastSent) >= e.period) {
+		if err := e.send(ctx, e.pending, e.dropped); err != nil {
+			errs = append(errs, err)
+		} else {
+			e.pending, e.dropped, e.lastSent = nil, 0, time.Now()
+		}
+	}
+	if e.store != nil {
+		if err := e.store.SaveEmailDigest(e.pending, e.dropped, e.lastSent); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save the digest queue: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Email) render(runs []scheduler.RunStats, dropped int) (string, []byte, []byte, error) {
+	data := digestData{Subject: digestSubject(runs), Dropped: dropped}
+	for _, stats := range runs {
+		data.Runs = append(data.Runs, newDigestRun(stats))
+	}
+	var text, html bytes.Buffer
+	if err := textDigest.Execute(&text, data); err != nil {
+		return "", nil, nil, err
+	}
+	if err := htmlDigest.Execute(&html, data); err != nil {
+		return "", nil, nil, err
+	}
+	return data.Subject, text.Bytes(), html.Bytes(), nil
+}
+
+// buildMessage assembles a multipart/alternative message with quoted-printable
+// plain-text and HTML parts.
+func (e *Email) buildMessage(subject string, text, html []byte) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	messageID := make([]byte, 12)
+	_, _ = rand.Read(messageID)
+	from, err := mail.ParseAddress(e.cfg.From)
+	if err != nil {
+		return nil, err
+	}
+	to := make([]string, 0, len(e.cfg.To))
+	for _, recipient := range e.cfg.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, err
+		}
+		to = append(to, address.String())
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		fmt.Fprintf(&msg, "Message-ID: <%s%s>\r\n", hex.EncodeToString(messageID), from.Address[at:])
+	}
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func (e *Email) send(ctx context.Context, runs []scheduler.RunStats, dropped int) error {
+	subject, text, html, err := e.render(runs, dropped)
+	if err != nil {
+		return fmt.Errorf("failed to render digest: %w", err)
+	}
+	msg, err := e.buildMessage(subject, text, html)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.SMTPPort()))
+	tlsConfig := &tls.Config{ServerName: e.cfg.Host}
+	var conn net.Conn
+	if e.cfg.Security == config.SMTPSecurityTLS {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if e.cfg.Security == config.SMTPSecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server does not offer STARTTLS; set security to tls or none")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if e.cfg.Username != "" {
+		// PlainAuth refuses to send the password unencrypted except to localhost.
+		if err := client.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	from, err := mail.ParseAddress(e.cfg.From)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := client.Rcpt(address.Address); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
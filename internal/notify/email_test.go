@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"kotei/internal/config"
+	"kotei/internal/scheduler"
+)
+
+// memoryDigestStore is a DigestStore held in memory.
+type memoryDigestStore struct {
+	pending  []scheduler.RunStats
+	dropped  int
+	lastSent time.Time
+}
+
+func (s *memoryDigestStore) EmailDigest() ([]scheduler.RunStats, int, time.Time, error) {
+	return s.pending, s.dropped, s.lastSent, nil
+}
+
+func (s *memoryDigestStore) SaveEmailDigest(pending []scheduler.RunStats, dropped int, lastSent time.Time) error {
+	s.pending, s.dropped, s.lastSent = pending, dropped, lastSent
+	return nil
+}
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestEmailQueueCap(t *testing.T) {
+	email := NewEmail(config.EmailConfig{
+		Host:           "127.0.0.1",
+		Port:           closedPort(t),
+		From:           "kotei@example.com",
+		To:             []string{"me@example.com"},
+		TimeoutSeconds: 1,
+	})
+	store := &memoryDigestStore{}
+	email.SetStore(store)
+
+	const runs = maxDigestRuns + 5
+	for i := range runs {
+		stats := scheduler.RunStats{ID: fmt.Sprintf("run-%d", i), Processed: 1, Errors: 1, Failed: 1}
+		if err := email.Notify(context.Background(), stats, nil); err == nil {
+			t.Fatalf("Notify() of run %d succeeded without a mail server", i)
+		}
+	}
+	if len(store.pending) != maxDigestRuns || store.dropped != 5 {
+		t.Fatalf("queue holds %d runs and dropped %d, want %d and 5", len(store.pending), store.dropped, maxDigestRuns)
+	}
+	if first := store.pending[0].ID; first != "run-5" {
+		t.Errorf("oldest queued run = %s, want run-5", first)
+	}
+
+	_, text, html, err := email.render(store.pending, store.dropped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("5 older runs were dropped from this digest, it keeps the last %d.", maxDigestRuns)
+	if !strings.Contains(string(text), want) || !strings.Contains(string(html), want) {
+		t.Errorf("digest does not mention the dropped runs:\n%s", text[:200])
+	}
+}
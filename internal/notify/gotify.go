@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"kotei/internal/config"
+	"kotei/internal/scheduler"
+)
+
+// Gotify message priorities; Gotify's Android app alerts from 4 and rings
+// from 8.
+const (
+	gotifyPriorityDefault = 5
+	gotifyPriorityHigh    = 8
+)
+
+type gotifyMessage struct {
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Priority int            `json:"priority"`
+	Extras   map[string]any `json:"extras,omitempty"`
+}
+
+// Gotify sends one message per changed or failing anime entry to a Gotify
+// application, clicking through to the series in Sonarr.
+type Gotify struct {
+	cfg        config.PushConfig
+	sonarrURL  string
+	httpClient *http.Client
+}
+
+func NewGotify(cfg config.PushConfig, sonarrURL string) *Gotify {
+	return &Gotify{cfg: cfg, sonarrURL: sonarrURL, httpClient: &http.Client{Timeout: chatTimeout}}
+}
+
+func (g *Gotify) Name() string {
+	return "gotify " + g.cfg.DisplayName()
+}
+
+// Notify sends the run's messages, stopping at the first failure.
+func (g *Gotify) Notify(ctx context.Context, stats scheduler.RunStats, _ []Event) error {
+	for _, push := range pushMessages(stats, g.sonarrURL) {
+		message := gotifyMessage{Title: push.Title, Message: push.Message, Priority: gotifyPriorityDefault}
+		if push.Problem {
+			message.Priority = gotifyPriorityHigh
+		}
+		if push.Click != "" {
+			message.Extras = map[string]any{
+				"client::notification": map[string]any{"click": map[string]string{"url": push.Click}},
+			}
+		}
+		if err := g.send(ctx, message); err != nil {
+			return fmt.Errorf("%s: %w", push.Title, err)
+		}
+	}
+	return nil
+}
+
+func (g *Gotify) send(ctx context.Context, message gotifyMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(g.cfg.URL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kotei")
+	req.Header.Set("X-Gotify-Key", g.cfg.Token)
+	return do(g.httpClient, req)
+}
@@ -0,0 +1,316 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"kotei/internal/config"
+	"kotei/internal/logging"
+	"kotei/internal/metrics"
+	"kotei/internal/processor"
+	"kotei/internal/scheduler"
+	"kotei/internal/util"
+)
+
+const (
+	EventEpisodesMonitored   = "episodes_monitored"
+	EventEpisodesUnmonitored = "episodes_unmonitored"
+	EventSearchQueued        = "search_queued"
+	EventSeriesNotFound      = "series_not_found"
+	EventRunFailed           = "run_failed"
+)
+
+// AllEvents lists every event type, in the order they are sent within a run.
+var AllEvents = []string{
+	EventEpisodesMonitored,
+	EventEpisodesUnmonitored,
+	EventSearchQueued,
+	EventSeriesNotFound,
+	EventRunFailed,
+}
+
+// Episode is a Sonarr episode an event refers to.
+type Episode struct {
+	Number  int    `json:"number"`
+	Season  int    `json:"season"`
+	Episode int    `json:"episode"`
+	Title   string `json:"title"`
+}
+
+// Failure is an anime entry that failed within a run.
+type Failure struct {
+	Anime string `json:"anime"`
+	Error string `json:"error"`
+}
+
+// RunSummary carries the numbers of a run's "[Run Stats]" line.
+type RunSummary struct {
+	Result          string  `json:"result"`
+	Processed       int     `json:"processed"`
+	OK              int     `json:"ok"`
+	Skipped         int     `json:"skipped"`
+	Failed          int     `json:"failed"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// Event is one notable thing that happened in a run. Webhook body templates
+// are rendered with it, and it is the default JSON body.
+type Event struct {
+	Type        string     `json:"type"`
+	Time        time.Time  `json:"time"`
+	RunID       string     `json:"run_id"`
+	Trigger     string     `json:"trigger"`
+	DryRun      bool       `json:"dry_run"`
+	Anime       string     `json:"anime,omitempty"`
+	SeriesID    int        `json:"sonarr_series_id,omitempty"`
+	SeriesTitle string     `json:"sonarr_series_title,omitempty"`
+	SeriesSlug  string     `json:"sonarr_series_slug,omitempty"`
+	Episodes    []Episode  `json:"episodes,omitempty"`
+	Ranges      string     `json:"episode_ranges,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Failures    []Failure  `json:"failures,omitempty"`
+	Run         RunSummary `json:"run"`
+}
+
+func episodes(planned []processor.PlannedEpisode) []Episode {
+	out := make([]Episode, 0, len(planned))
+	for _, ep := range planned {
+		out = append(out, Episode{Number: ep.Number, Season: ep.SeasonNumber, Episode: ep.EpisodeNumber, Title: ep.Title})
+	}
+	return out
+}
+
+// Ranges compresses the episode numbers into text such as "1071-1074, 1080".
+func Ranges(eps []Episode) string {
+	numbers := make([]int, 0, len(eps))
+	for _, ep := range eps {
+		numbers = append(numbers, ep.Number)
+	}
+	return util.FormatEpisodeRanges(numbers)
+}
+
+// Events derives the events of a finished run: per anime entry the
+// episodes monitored, unmonitored and searched and a missing series, then
+// run_failed when any entry failed.
+func Events(stats scheduler.RunStats) []Event {
+	base := Event{
+		Time:    stats.FinishedAt,
+		RunID:   stats.ID,
+		Trigger: stats.Trigger,
+		DryRun:  stats.DryRun,
+		Run: RunSummary{
+			Result:          stats.Result(),
+			Processed:       stats.Processed,
+			OK:              stats.OK,
+			Skipped:         stats.Skipped,
+			Failed:          stats.Failed,
+			DurationSeconds: stats.Duration().Seconds(),
+		},
+	}
+
+	var events []Event
+	var failures []Failure
+	for _, result := range stats.Animes {
+		animeEvent := base
+		animeEvent.Anime = result.Anime
+		animeEvent.SeriesID = result.SeriesID
+		animeEvent.SeriesTitle = result.SeriesTitle
+		animeEvent.SeriesSlug = result.SeriesSlug
+
+		for _, change := range []struct {
+			eventType string
+			episodes  []processor.PlannedEpisode
+		}{
+			{EventEpisodesMonitored, result.Monitored},
+			{EventEpisodesUnmonitored, result.Unmonitored},
+			{EventSearchQueued, result.Searched},
+		} {
+			if len(change.episodes) == 0 {
+				continue
+			}
+			event := animeEvent
+			event.Type = change.eventType
+			event.Episodes = episodes(change.episodes)
+			event.Ranges = Ranges(event.Episodes)
+			events = append(events, event)
+		}
+
+		switch result.Status {
+		case scheduler.AnimeStatusNotFound:
+			event := animeEvent
+			event.Type = EventSeriesNotFound
+			event.Error = result.Error
+			events = append(events, event)
+		case scheduler.AnimeStatusError:
+			failures = append(failures, Failure{Anime: result.Anime, Error: result.Error})
+		}
+	}
+
+	if stats.Failed > 0 {
+		event := base
+		event.Type = EventRunFailed
+		event.Error = fmt.Sprintf("%d of %d anime entries failed", stats.Failed, stats.Processed)
+		event.Failures = failures
+		events = append(events, event)
+	}
+	return events
+}
+
+// Target is a notification backend.
+type Target interface {
+	Name() string
+	// Notify sends what the target reports about a finished run. events are
+	// the run's Events.
+	Notify(ctx context.Context, stats scheduler.RunStats, events []Event) error
+}
+
+// Validate checks the notification settings that config.Validate cannot,
+// such as event names and body templates.
+func Validate(cfg config.Config) config.ValidationErrors {
+	var errs config.ValidationErrors
+	for i, webhookCfg := range cfg.Notifications.Webhooks {
+		path := fmt.Sprintf("notifications.webhooks[%d]", i)
+		for j, event := range webhookCfg.Events {
+			if !slices.Contains(AllEvents, event) {
+				errs.Add(fmt.Sprintf("%s.events[%d]", path, j), "unknown event '%s' (expected one of %v)", event, AllEvents)
+			}
+		}
+		if _, err := parseBody(webhookCfg); err != nil {
+			errs.Add(path+".body", "%v", err)
+		}
+	}
+	return errs
+}
+
+func buildTargets(cfg config.Config) ([]Target, error) {
+	var targets []Target
+	for _, webhookCfg := range cfg.Notifications.Webhooks {
+		webhook, err := NewWebhook(webhookCfg)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, webhook)
+	}
+	for _, chatCfg := range cfg.Notifications.Discord {
+		targets = append(targets, NewDiscord(chatCfg))
+	}
+	for _, chatCfg := range cfg.Notifications.Slack {
+		targets = append(targets, NewSlack(chatCfg))
+	}
+	if cfg.Notifications.Email.Host != "" {
+		targets = append(targets, NewEmail(cfg.Notifications.Email))
+	}
+	for _, pushCfg := range cfg.Notifications.Ntfy {
+		targets = append(targets, NewNtfy(pushCfg, cfg.Sonarr.BaseURL))
+	}
+	for _, pushCfg := range cfg.Notifications.Gotify {
+		targets = append(targets, NewGotify(pushCfg, cfg.Sonarr.BaseURL))
+	}
+	return targets, nil
+}
+
+// Dispatcher sends every finished run to the configured targets. It
+// implements scheduler.Notifier.
+type Dispatcher struct {
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	cfg     config.Config
+	store   DigestStore
+	targets []Target
+}
+
+// New creates a dispatcher for the notification targets in cfg.
+func New(cfg config.Config, logger *slog.Logger) (*Dispatcher, error) {
+	d := &Dispatcher{logger: logging.OrDiscard(logger).With(logging.ComponentKey, "notify")}
+	if _, err := d.Configure(cfg); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Configure replaces the targets with those in cfg and reports whether the
+// notification settings changed. On error the current targets are kept.
+func (d *Dispatcher) Configure(cfg config.Config) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Push targets link to Sonarr, so they are rebuilt when its URL changes.
+	if d.targets != nil && reflect.DeepEqual(d.cfg.Notifications, cfg.Notifications) &&
+		d.cfg.Sonarr.BaseURL == cfg.Sonarr.BaseURL {
+		return false, nil
+	}
+	targets, err := buildTargets(cfg)
+	if err != nil {
+		return false, err
+	}
+	if targets == nil {
+		targets = []Target{}
+	}
+	for i, target := range targets {
+		email, ok := target.(*Email)
+		if !ok {
+			continue
+		}
+		// An unchanged email target is kept along with its digest queue.
+		if current := d.email(); current != nil && reflect.DeepEqual(current.cfg, email.cfg) {
+			targets[i] = current
+		} else if d.store != nil {
+			email.SetStore(d.store)
+		}
+	}
+	d.cfg, d.targets = cfg, targets
+	return true, nil
+}
+
+// SetDigestStore keeps the queue of a daily or weekly email digest in store.
+func (d *Dispatcher) SetDigestStore(store DigestStore) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.store = store
+	if email := d.email(); email != nil {
+		email.SetStore(store)
+	}
+}
+
+// email returns the current email target, if any. d.mu must be held.
+func (d *Dispatcher) email() *Email {
+	for _, target := range d.targets {
+		if email, ok := target.(*Email); ok {
+			return email
+		}
+	}
+	return nil
+}
+
+// Targets returns the number of configured targets.
+func (d *Dispatcher) Targets() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.targets)
+}
+
+// RunFinished sends the run to every target. Failures are logged and do not
+// affect the run's result.
+func (d *Dispatcher) RunFinished(ctx context.Context, stats scheduler.RunStats) {
+	d.mu.RLock()
+	targets := d.targets
+	d.mu.RUnlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	events := Events(stats)
+	for _, target := range targets {
+		if err := target.Notify(ctx, stats, events); err != nil {
+			metrics.NotificationSent(target.Name(), "error")
+			d.logger.Warn("Notification failed", "target", target.Name(), "run_id", stats.ID, "error", err)
+			continue
+		}
+		metrics.NotificationSent(target.Name(), "ok")
+	}
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"kotei/internal/config"
+	"kotei/internal/scheduler"
+)
+
+// ntfy message priorities.
+const (
+	ntfyPriorityDefault = 3
+	ntfyPriorityHigh    = 4
+)
+
+type ntfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags,omitempty"`
+	Click    string   `json:"click,omitempty"`
+}
+
+// Ntfy publishes one message per changed or failing anime entry to an ntfy
+// topic, clicking through to the series in Sonarr.
+type Ntfy struct {
+	cfg        config.PushConfig
+	serverURL  string
+	sonarrURL  string
+	httpClient *http.Client
+}
+
+func NewNtfy(cfg config.PushConfig, sonarrURL string) *Ntfy {
+	serverURL := cfg.URL
+	if serverURL == "" {
+		serverURL = config.DefaultNtfyURL
+	}
+	return &Ntfy{
+		cfg:        cfg,
+		serverURL:  strings.TrimSuffix(serverURL, "/"),
+		sonarrURL:  sonarrURL,
+		httpClient: &http.Client{Timeout: chatTimeout},
+	}
+}
+
+func (n *Ntfy) Name() string {
+	return "ntfy " + n.cfg.DisplayName()
+}
+
+// Notify publishes the run's messages, stopping at the first failure.
+func (n *Ntfy) Notify(ctx context.Context, stats scheduler.RunStats, _ []Event) error {
+	for _, push := range pushMessages(stats, n.sonarrURL) {
+		message := ntfyMessage{
+			Topic:    n.cfg.Topic,
+			Title:    push.Title,
+			Message:  push.Message,
+			Priority: ntfyPriorityDefault,
+			Tags:     append([]string{}, n.cfg.Tags...),
+			Click:    push.Click,
+		}
+		if push.Problem {
+			message.Priority = ntfyPriorityHigh
+			message.Tags = append(message.Tags, "warning")
+		} else {
+			message.Tags = append(message.Tags, "tv")
+		}
+		if err := n.publish(ctx, message); err != nil {
+			return fmt.Errorf("%s: %w", push.Title, err)
+		}
+	}
+	return nil
+}
+
+// publish uses ntfy's JSON publishing, which posts to the server root.
+func (n *Ntfy) publish(ctx context.Context, message ntfyMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.serverURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kotei")
+	if n.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.cfg.Token)
+	}
+	return do(n.httpClient, req)
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"kotei/internal/config"
+	"kotei/internal/scheduler"
+)
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Blocks      []slackBlock      `json:"blocks"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+// Slack posts a run summary as Block Kit blocks to a Slack incoming webhook.
+// Problems go into an attachment with a red bar, since blocks have no color.
+type Slack struct {
+	cfg        config.ChatConfig
+	httpClient *http.Client
+}
+
+func NewSlack(cfg config.ChatConfig) *Slack {
+	return &Slack{cfg: cfg, httpClient: &http.Client{Timeout: chatTimeout}}
+}
+
+func (s *Slack) Name() string {
+	return "slack " + s.cfg.DisplayName()
+}
+
+func (s *Slack) Notify(ctx context.Context, stats scheduler.RunStats, _ []Event) error {
+	if isQuiet(stats) && !s.cfg.NotifyQuietRuns {
+		return nil
+	}
+	body, err := json.Marshal(slackPayload(summarize(stats)))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(s.httpClient, req)
+}
+
+// slackEscape escapes the characters mrkdwn treats as control sequences.
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func slackSection(line animeLine, withError bool) slackBlock {
+	text := "*" + slackEscape(line.Anime) + "*"
+	for _, l := range line.Lines {
+		text += "\n" + slackEscape(l)
+	}
+	if withError && line.Error != "" {
+		text += "\n" + slackEscape(line.Error)
+	}
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncate(text, 3000)}}
+}
+
+func slackPayload(summary runSummary) slackMessage {
+	contextText := summary.Counts
+	if summary.DryRun {
+		contextText = "`DRY RUN` · " + contextText
+	}
+	message := slackMessage{
+		Text: summary.Title + ": " + summary.Counts,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: truncate(summary.Title, 150)}},
+			{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: contextText}}},
+		},
+	}
+	if len(summary.Changed) == 0 && len(summary.Problems) == 0 {
+		message.Blocks = append(message.Blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "All quiet, nothing changed."}})
+	}
+	for _, line := range summary.Changed {
+		message.Blocks = append(message.Blocks, slackSection(line, false))
+	}
+	if summary.Omitted > 0 {
+		message.Blocks = append(message.Blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn",
+			Text: fmt.Sprintf("…and %d more anime entries not listed.", summary.Omitted)}})
+	}
+	message.Blocks = append(message.Blocks, slackBlock{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: summary.Footer}}})
+
+	if len(summary.Problems) > 0 {
+		problems := slackAttachment{Color: fmt.Sprintf("#%06X", colorFailed)}
+		for _, line := range summary.Problems {
+			problems.Blocks = append(problems.Blocks, slackSection(line, true))
+		}
+		message.Attachments = append(message.Attachments, problems)
+	}
+	return message
+}
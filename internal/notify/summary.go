@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kotei/internal/processor"
+	"kotei/internal/scheduler"
+	"kotei/internal/sonarr"
+	"kotei/internal/util"
+)
+
+// Colors of chat summaries by run result.
+const (
+	colorSuccess = 0x2ECC71
+	colorPartial = 0xE67E22
+	colorFailed  = 0xE74C3C
+)
+
+// maxListedAnimes caps the per-anime sections of a chat message, keeping it
+// within Discord's 25 fields and Slack's 50 blocks.
+const maxListedAnimes = 20
+
+// animeLine is the chat summary of one anime entry that changed something or
+// had a problem.
+type animeLine struct {
+	Anime      string
+	SeriesSlug string
+	Lines      []string
+	Error      string
+}
+
+// runSummary is the common content of the Discord and Slack messages.
+type runSummary struct {
+	Title     string
+	Counts    string
+	Footer    string
+	Color     int
+	DryRun    bool
+	Timestamp time.Time
+	Changed   []animeLine
+	Problems  []animeLine
+	// Omitted counts entries left out beyond maxListedAnimes.
+	Omitted int
+}
+
+// compactRanges formats episode numbers like "1071–1074, 1080", with an en
+// dash as chat messages are read by people.
+func compactRanges(planned []processor.PlannedEpisode) string {
+	numbers := make([]int, 0, len(planned))
+	for _, ep := range planned {
+		numbers = append(numbers, ep.Number)
+	}
+	return strings.ReplaceAll(util.FormatEpisodeRanges(numbers), "-", "–")
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// isQuiet reports whether the run changed nothing and had no problems.
+func isQuiet(stats scheduler.RunStats) bool {
+	if stats.Errors > 0 {
+		return false
+	}
+	for _, result := range stats.Animes {
+		if result.ActionTaken {
+			return false
+		}
+	}
+	return true
+}
+
+// summarize builds the chat summary of a run, listing at most
+// maxListedAnimes entries.
+func summarize(stats scheduler.RunStats) runSummary {
+	summary := summarizeAll(stats)
+	if listed := len(summary.Problems) + len(summary.Changed); listed > maxListedAnimes {
+		summary.Omitted = listed - maxListedAnimes
+		if len(summary.Problems) > maxListedAnimes {
+			summary.Problems = summary.Problems[:maxListedAnimes]
+		}
+		summary.Changed = summary.Changed[:maxListedAnimes-len(summary.Problems)]
+	}
+	return summary
+}
+
+// summarizeAll builds the summary of a run with every entry that changed
+// something or had a problem.
+func summarizeAll(stats scheduler.RunStats) runSummary {
+	summary := runSummary{
+		Title: "Kotei run " + stats.Result(),
+		Counts: fmt.Sprintf("%d processed · %d ok · %d skipped · %d failed",
+			stats.Processed, stats.OK, stats.Skipped, stats.Failed),
+		Footer:    fmt.Sprintf("run %s · %s · %s", stats.ID, stats.Trigger, stats.Duration().Round(time.Millisecond)),
+		DryRun:    stats.DryRun,
+		Timestamp: stats.FinishedAt,
+	}
+	switch stats.Result() {
+	case "failed":
+		summary.Color = colorFailed
+	case "partial":
+		summary.Color = colorPartial
+	default:
+		summary.Color = colorSuccess
+	}
+	if stats.Interrupted {
+		summary.Counts += " · interrupted"
+	}
+
+	verb := func(done, dryRun string) string {
+		if stats.DryRun {
+			return dryRun
+		}
+		return done
+	}
+	for _, result := range stats.Animes {
+		line := animeLine{Anime: result.Anime, SeriesSlug: result.SeriesSlug}
+		if len(result.Monitored) > 0 {
+			line.Lines = append(line.Lines, fmt.Sprintf("%s %s: %s",
+				verb("Monitored", "Would monitor"), plural(len(result.Monitored), "episode"), compactRanges(result.Monitored)))
+		}
+		if len(result.Unmonitored) > 0 {
+			line.Lines = append(line.Lines, fmt.Sprintf("%s %s: %s",
+				verb("Unmonitored", "Would unmonitor"), plural(len(result.Unmonitored), "episode"), compactRanges(result.Unmonitored)))
+		}
+		if len(result.Searched) > 0 {
+			line.Lines = append(line.Lines, fmt.Sprintf("%s for %s",
+				verb("Search queued", "Would queue search"), plural(len(result.Searched), "episode")))
+		}
+		switch {
+		case result.Status != scheduler.AnimeStatusOK:
+			line.Error = result.Error
+			summary.Problems = append(summary.Problems, line)
+		case len(line.Lines) > 0:
+			summary.Changed = append(summary.Changed, line)
+		}
+	}
+	return summary
+}
+
+// truncate shortens text to at most limit runes, marking the cut.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// pushMessage is one ntfy or Gotify message, about a single anime entry.
+type pushMessage struct {
+	Title   string
+	Message string
+	// Problem marks an entry that failed or was skipped, sent at high
+	// priority; changes are sent at normal priority.
+	Problem bool
+	// Click is the Sonarr series page, empty when the series is unknown.
+	Click string
+}
+
+// pushMessages turns a run into one message per anime entry that changed
+// something or had a problem. Quiet runs produce none. Unlike chat messages
+// they are not capped at maxListedAnimes, as each entry is its own message.
+func pushMessages(stats scheduler.RunStats, sonarrURL string) []pushMessage {
+	summary := summarizeAll(stats)
+	var messages []pushMessage
+	add := func(line animeLine, problem bool) {
+		title := line.Anime
+		if summary.DryRun {
+			title = "[DRY RUN] " + title
+		}
+		text := strings.Join(line.Lines, "\n")
+		if line.Error != "" {
+			text = strings.TrimSpace(text + "\n" + line.Error)
+		}
+		messages = append(messages, pushMessage{
+			Title:   title,
+			Message: text,
+			Problem: problem,
+			Click:   sonarr.SeriesURL(sonarrURL, line.SeriesSlug),
+		})
+	}
+	for _, line := range summary.Problems {
+		add(line, true)
+	}
+	for _, line := range summary.Changed {
+		add(line, false)
+	}
+	return messages
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"kotei/internal/config"
+	"kotei/internal/scheduler"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// templateFuncs are available in webhook body templates.
+var templateFuncs = template.FuncMap{
+	// json encodes a value, e.g. to embed a title in a JSON body safely.
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"ranges": Ranges,
+	"join":   strings.Join,
+}
+
+func parseBody(cfg config.WebhookConfig) (*template.Template, error) {
+	if strings.TrimSpace(cfg.Body) == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(cfg.DisplayName()).Funcs(templateFuncs).Option("missingkey=error").Parse(cfg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Webhook sends one HTTP request per event to a configured URL.
+type Webhook struct {
+	cfg        config.WebhookConfig
+	method     string
+	body       *template.Template
+	httpClient *http.Client
+}
+
+func NewWebhook(cfg config.WebhookConfig) (*Webhook, error) {
+	body, err := parseBody(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", cfg.DisplayName(), err)
+	}
+	method := strings.ToUpper(strings.TrimSpace(cfg.Method))
+	if method == "" {
+		method = http.MethodPost
+	}
+	timeout := defaultWebhookTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return &Webhook{
+		cfg:        cfg,
+		method:     method,
+		body:       body,
+		httpClient: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (w *Webhook) Name() string {
+	return "webhook " + w.cfg.DisplayName()
+}
+
+func (w *Webhook) wants(eventType string) bool {
+	return len(w.cfg.Events) == 0 || slices.Contains(w.cfg.Events, eventType)
+}
+
+// Notify sends the events the webhook subscribed to, stopping at the first
+// failure.
+func (w *Webhook) Notify(ctx context.Context, _ scheduler.RunStats, events []Event) error {
+	for _, event := range events {
+		if !w.wants(event.Type) {
+			continue
+		}
+		if err := w.send(ctx, event); err != nil {
+			return fmt.Errorf("%s event: %w", event.Type, err)
+		}
+	}
+	return nil
+}
+
+func (w *Webhook) render(event Event) ([]byte, error) {
+	if w.body == nil {
+		return json.Marshal(event)
+	}
+	var buf bytes.Buffer
+	if err := w.body.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("failed to render body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Webhook) send(ctx context.Context, event Event) error {
+	body, err := w.render(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, w.method, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kotei")
+	for name, value := range w.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	return do(w.httpClient, req)
+}
+
+// do sends req and fails on any non-2xx response, quoting the start of its
+// body. The URL is left out of errors since chat webhook URLs embed their
+// token.
+func do(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s failed: %w", req.Method, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", req.Method, resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,336 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kotei/internal/canon"
+	"kotei/internal/config"
+	"kotei/internal/episodemap"
+	"kotei/internal/sonarr"
+	"kotei/internal/util"
+)
+
+type Action string
+
+const (
+	ActionMonitor   Action = "monitor"
+	ActionUnmonitor Action = "unmonitor"
+	ActionSearch    Action = "search"
+)
+
+// PlannedEpisode is a single Sonarr episode a plan will act on.
+type PlannedEpisode struct {
+	EpisodeID     int    `json:"episode_id"`
+	Number        int    `json:"number"`
+	SeasonNumber  int    `json:"season"`
+	EpisodeNumber int    `json:"episode"`
+	Title         string `json:"title"`
+	Reason        string `json:"reason"`
+	// WasMonitored is the episode's monitored flag in Sonarr when the plan
+	// was built, which 'kotei rollback' restores.
+	WasMonitored bool `json:"was_monitored"`
+}
+
+// Plan is the full set of changes for one anime entry. It is produced by
+// BuildPlan without touching Sonarr and executed by ApplyPlan.
+type Plan struct {
+	Anime            string               `json:"anime"`
+	SeriesID         int                  `json:"sonarr_series_id"`
+	SeriesTitle      string               `json:"sonarr_series_title"`
+	SeriesSlug       string               `json:"sonarr_series_slug,omitempty"`
+	MatchStrategy    sonarr.MatchStrategy `json:"match_by"`
+	Monitor          []PlannedEpisode     `json:"monitor"`
+	Unmonitor        []PlannedEpisode     `json:"unmonitor"`
+	Search           []PlannedEpisode     `json:"search"`
+	IncludeTypes     []canon.Type         `json:"include_types"`
+	CanonCount       int                  `json:"canon_count"`
+	AlreadyMonitored int                  `json:"already_monitored"`
+	NotFound         []int                `json:"not_found,omitempty"`
+	UnmappedEpisodes []int                `json:"unmapped,omitempty"`
+	Warnings         []string             `json:"warnings,omitempty"`
+	Strict           *StrictPlanDetails   `json:"strict,omitempty"`
+
+	episodeTypes   map[int]canon.Type
+	episodeDetails map[int]canon.Episode
+}
+
+// StrictPlanDetails records how strict sync mode arrived at its unmonitor list.
+type StrictPlanDetails struct {
+	ConsideredCount int    `json:"considered_count"`
+	LimitPercent    int    `json:"limit_percent"`
+	Refused         int    `json:"refused,omitempty"`
+	RefusedEpisodes string `json:"refused_episodes,omitempty"`
+}
+
+// HasChanges reports whether applying the plan would change anything in Sonarr.
+func (p *Plan) HasChanges() bool {
+	return len(p.Monitor) > 0 || len(p.Unmonitor) > 0 || len(p.Search) > 0
+}
+
+// PlanFile is the on-disk form of a saved plan, as written by `kotei plan --out`.
+type PlanFile struct {
+	CreatedAt time.Time `json:"created_at"`
+	DryRun    bool      `json:"dry_run"`
+	Plans     []*Plan   `json:"plans"`
+}
+
+func typeReason(t canon.Type) string {
+	switch t {
+	case canon.Manga:
+		return "manga canon"
+	case canon.Mixed:
+		return "mixed canon/filler"
+	case canon.Anime:
+		return "anime canon"
+	case canon.Filler:
+		return "filler"
+	}
+	return ""
+}
+
+// BuildPlan computes the changes for one anime entry from the canon list and
+// the series' current Sonarr episodes. It performs no I/O. When strict mode
+// would exceed the unmonitor threshold, the plan is still returned, without
+// unmonitor entries, together with ErrUnmonitorThresholdExceeded.
+func BuildPlan(cfg config.AnimeConfig, episodeList *canon.EpisodeList, series sonarr.Series, episodes []sonarr.Episode) (*Plan, error) {
+	matchStrategy, err := sonarr.ParseMatchStrategy(cfg.MatchBy)
+	if err != nil {
+		return nil, err
+	}
+	episodeMapper, err := episodemap.New(cfg.EpisodeMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		Anime:          cfg.DisplayName(),
+		SeriesID:       series.ID,
+		SeriesTitle:    series.Title,
+		SeriesSlug:     series.TitleSlug,
+		MatchStrategy:  matchStrategy,
+		Monitor:        []PlannedEpisode{},
+		Unmonitor:      []PlannedEpisode{},
+		Search:         []PlannedEpisode{},
+		IncludeTypes:   canon.ParseTypes(cfg.IncludeCanonTypes),
+		episodeTypes:   make(map[int]canon.Type),
+		episodeDetails: make(map[int]canon.Episode),
+	}
+	if matchStrategy == sonarr.MatchAbsolute && series.SeriesType != "" && !strings.EqualFold(series.SeriesType, "anime") {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("Series type in Sonarr is '%s', not 'anime'; absolute episode numbers may be missing. Consider match_by: season_order.", series.SeriesType))
+	}
+
+	// Key everything the canon list knows by Sonarr number so reasons can be
+	// given for both monitored and unmonitored episodes. Types are visited in
+	// a fixed order and the first one wins, so an episode listed twice keeps
+	// the same reason from run to run.
+	for _, t := range []canon.Type{canon.Manga, canon.Mixed, canon.Anime, canon.Filler} {
+		for _, n := range episodeList.Categories[t] {
+			target, ok := episodeMapper.Map(n)
+			if !ok {
+				continue
+			}
+			if _, known := p.episodeTypes[target]; known {
+				continue
+			}
+			p.episodeTypes[target] = t
+			if detail, ok := episodeList.Details[n]; ok {
+				p.episodeDetails[target] = detail
+			}
+		}
+	}
+
+	episodesToProcess := []int{}
+	for _, ep := range episodeList.Select(cfg.IncludeCanonTypes) {
+		if ep >= cfg.CutoffEpisode {
+			episodesToProcess = append(episodesToProcess, ep)
+		}
+	}
+	p.CanonCount = len(episodesToProcess)
+
+	sonarrEpisodes, dropped := episodeMapper.MapAll(episodesToProcess)
+	p.UnmappedEpisodes = dropped
+	sonarrCutoff := cfg.CutoffEpisode
+	if mappedCutoff, ok := episodeMapper.Map(cfg.CutoffEpisode); ok {
+		sonarrCutoff = mappedCutoff
+	}
+
+	index := sonarr.IndexEpisodes(episodes, matchStrategy)
+	for _, number := range sonarrEpisodes {
+		ep, ok := index[number]
+		if !ok {
+			p.NotFound = append(p.NotFound, number)
+			continue
+		}
+		if ep.Monitored {
+			p.AlreadyMonitored++
+			continue
+		}
+		p.Monitor = append(p.Monitor, p.plannedEpisode(ep, typeReason(p.episodeTypes[number])))
+	}
+	if cfg.SearchEnabled {
+		for _, planned := range p.Monitor {
+			planned.Reason = "newly monitored"
+			p.Search = append(p.Search, planned)
+		}
+	}
+
+	if cfg.IsStrict() && len(sonarrEpisodes) > 0 {
+		return p, p.planUnmonitor(cfg, index, sonarrEpisodes, sonarrCutoff)
+	}
+	return p, nil
+}
+
+func (p *Plan) plannedEpisode(ep sonarr.Episode, reason string) PlannedEpisode {
+	title := ep.Title
+	if title == "" {
+		title = p.episodeDetails[ep.MatchNumber].Title
+	}
+	return PlannedEpisode{
+		EpisodeID:     ep.ID,
+		Number:        ep.MatchNumber,
+		SeasonNumber:  ep.SeasonNumber,
+		EpisodeNumber: ep.EpisodeNumber,
+		Title:         title,
+		Reason:        reason,
+		WasMonitored:  ep.Monitored,
+	}
+}
+
+// planUnmonitor fills in the unmonitor list for strict mode. Only episodes
+// between the cutoff and the last canon episode are eligible, so episodes that
+// aired after the canon list was last updated are left alone.
+func (p *Plan) planUnmonitor(cfg config.AnimeConfig, index map[int]sonarr.Episode, keep []int, cutoff int) error {
+	keepMap := make(map[int]bool, len(keep))
+	lastKept := 0
+	for _, n := range keep {
+		keepMap[n] = true
+		lastKept = util.Max(lastKept, n)
+	}
+
+	var candidates []PlannedEpisode
+	for number, ep := range index {
+		if number < cutoff || number > lastKept || !ep.Monitored || keepMap[number] {
+			continue
+		}
+		reason := "not on canon list"
+		if t, ok := p.episodeTypes[number]; ok {
+			reason = typeReason(t)
+			if t != canon.Filler {
+				reason += " (type not included)"
+			}
+		}
+		candidates = append(candidates, p.plannedEpisode(ep, reason))
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Number < candidates[j].Number })
+
+	p.Strict = &StrictPlanDetails{ConsideredCount: len(index), LimitPercent: cfg.UnmonitorLimitPercent()}
+	if len(index) > 0 && len(candidates)*100 > p.Strict.LimitPercent*len(index) {
+		numbers := make([]int, 0, len(candidates))
+		for _, c := range candidates {
+			numbers = append(numbers, c.Number)
+		}
+		p.Strict.Refused = len(candidates)
+		p.Strict.RefusedEpisodes = util.FormatEpisodeRanges(numbers)
+		return fmt.Errorf("%w: %d of %d episodes for '%s' (limit %d%%)",
+			ErrUnmonitorThresholdExceeded, len(candidates), len(index), cfg.DisplayName(), p.Strict.LimitPercent)
+	}
+	p.Unmonitor = append(p.Unmonitor, candidates...)
+	return nil
+}
+
+func episodeIDs(episodes []PlannedEpisode) []int {
+	ids := make([]int, 0, len(episodes))
+	for _, ep := range episodes {
+		ids = append(ids, ep.EpisodeID)
+	}
+	return ids
+}
+
+func episodeNumbers(episodes []PlannedEpisode) []int {
+	numbers := make([]int, 0, len(episodes))
+	for _, ep := range episodes {
+		numbers = append(numbers, ep.Number)
+	}
+	return numbers
+}
+
+// WritePlanTable renders plans as a human readable table.
+func WritePlanTable(w io.Writer, plans []*Plan) error {
+	for i, p := range plans {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s -> %s (Sonarr ID %d)\n", p.Anime, p.SeriesTitle, p.SeriesID)
+		fmt.Fprintf(w, "  canon: %d, already monitored: %d, not found: %d\n", p.CanonCount, p.AlreadyMonitored, len(p.NotFound))
+		for _, warning := range p.Warnings {
+			fmt.Fprintf(w, "  warning: %s\n", warning)
+		}
+		if p.Strict != nil && p.Strict.Refused > 0 {
+			fmt.Fprintf(w, "  strict: refusing to unmonitor %d of %d episodes (limit %d%%): %s\n",
+				p.Strict.Refused, p.Strict.ConsideredCount, p.Strict.LimitPercent, p.Strict.RefusedEpisodes)
+		}
+		if !p.HasChanges() {
+			fmt.Fprintln(w, "  no changes")
+			continue
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  ACTION\t#\tS/E\tTITLE\tREASON")
+		for _, group := range []struct {
+			action   Action
+			episodes []PlannedEpisode
+		}{
+			{ActionMonitor, p.Monitor},
+			{ActionUnmonitor, p.Unmonitor},
+			{ActionSearch, p.Search},
+		} {
+			for _, ep := range group.episodes {
+				fmt.Fprintf(tw, "  %s\t%d\tS%02dE%02d\t%s\t%s\n", group.action, ep.Number, ep.SeasonNumber, ep.EpisodeNumber, ep.Title, ep.Reason)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePlanJSON renders plans as an indented PlanFile.
+func WritePlanJSON(w io.Writer, planFile PlanFile) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(planFile)
+}
+
+// SavePlanFile writes a plan file for a later `kotei apply`.
+func SavePlanFile(path string, planFile PlanFile) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create plan file '%s': %w", path, err)
+	}
+	if err := WritePlanJSON(f, planFile); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write plan file '%s': %w", path, err)
+	}
+	return f.Close()
+}
+
+// LoadPlanFile reads a plan file written by SavePlanFile.
+func LoadPlanFile(path string) (PlanFile, error) {
+	var planFile PlanFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return planFile, fmt.Errorf("failed to read plan file '%s': %w", path, err)
+	}
+	if err := json.Unmarshal(data, &planFile); err != nil {
+		return planFile, fmt.Errorf("failed to parse plan file '%s': %w", path, err)
+	}
+	return planFile, nil
+}
@@ -0,0 +1,369 @@
+package processor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"kotei/internal/canon"
+	"kotei/internal/config"
+	"kotei/internal/sonarr"
+)
+
+var testSeries = sonarr.Series{ID: 7, Title: "One Piece", TitleSlug: "one-piece", SeriesType: "anime"}
+
+// span returns the numbers from through to.
+func span(from, to int) []int {
+	var numbers []int
+	for n := from; n <= to; n++ {
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+// join concatenates lists of episode numbers.
+func join(lists ...[]int) []int {
+	var numbers []int
+	for _, list := range lists {
+		numbers = append(numbers, list...)
+	}
+	return numbers
+}
+
+// testEpisodes returns Sonarr episodes with absolute numbers 1 through n in
+// season 1, with IDs 100 higher. All are monitored except those listed.
+func testEpisodes(n int, unmonitored ...int) []sonarr.Episode {
+	skip := make(map[int]bool, len(unmonitored))
+	for _, number := range unmonitored {
+		skip[number] = true
+	}
+	episodes := make([]sonarr.Episode, 0, n)
+	for number := 1; number <= n; number++ {
+		episodes = append(episodes, sonarr.Episode{
+			ID:                    100 + number,
+			AbsoluteEpisodeNumber: number,
+			SeasonNumber:          1,
+			EpisodeNumber:         number,
+			Monitored:             !skip[number],
+		})
+	}
+	return episodes
+}
+
+func testList(categories map[canon.Type][]int) *canon.EpisodeList {
+	list := canon.NewEpisodeList("test")
+	for t, numbers := range categories {
+		list.Categories[t] = numbers
+	}
+	return list
+}
+
+func reasons(episodes []PlannedEpisode) map[int]string {
+	out := make(map[int]string, len(episodes))
+	for _, ep := range episodes {
+		out[ep.Number] = ep.Reason
+	}
+	return out
+}
+
+func TestBuildPlanUnmonitor(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.AnimeConfig
+		list        map[canon.Type][]int
+		episodes    []sonarr.Episode
+		want        []int
+		wantReasons map[int]string
+		wantRefused int
+		wantRefusal string // refused episodes, when the threshold is exceeded
+		wantStrict  bool
+	}{
+		{
+			name:     "standard mode never unmonitors",
+			cfg:      config.AnimeConfig{SonarrTitle: "One Piece"},
+			list:     map[canon.Type][]int{canon.Manga: join(span(1, 5), span(11, 20)), canon.Filler: span(6, 10)},
+			episodes: testEpisodes(20),
+		},
+		{
+			name:        "strict below the threshold",
+			cfg:         config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict},
+			list:        map[canon.Type][]int{canon.Manga: join(span(1, 5), span(7, 9), span(12, 20)), canon.Filler: []int{6, 10}},
+			episodes:    testEpisodes(20),
+			want:        []int{6, 10, 11},
+			wantReasons: map[int]string{6: "filler", 10: "filler", 11: "not on canon list"},
+			wantStrict:  true,
+		},
+		{
+			name: "strict names excluded canon types",
+			cfg: config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict,
+				IncludeCanonTypes: []string{"manga"}},
+			list:        map[canon.Type][]int{canon.Manga: join(span(1, 9), span(11, 20)), canon.Anime: []int{10}},
+			episodes:    testEpisodes(20),
+			want:        []int{10},
+			wantReasons: map[int]string{10: "anime canon (type not included)"},
+			wantStrict:  true,
+		},
+		{
+			name:       "strict at exactly the limit",
+			cfg:        config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict},
+			list:       map[canon.Type][]int{canon.Manga: join([]int{1}, []int{3}, []int{5}, []int{7}, []int{9}, span(11, 20))},
+			episodes:   testEpisodes(20),
+			want:       []int{2, 4, 6, 8, 10},
+			wantStrict: true,
+		},
+		{
+			name:        "strict above the limit unmonitors nothing",
+			cfg:         config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict},
+			list:        map[canon.Type][]int{canon.Manga: join([]int{1}, []int{3}, []int{5}, []int{7}, []int{9}, []int{11}, span(13, 20))},
+			episodes:    testEpisodes(20),
+			wantRefused: 6,
+			wantRefusal: "2, 4, 6, 8, 10, 12",
+			wantStrict:  true,
+		},
+		{
+			name: "a share just above a custom limit is not rounded down",
+			cfg: config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict,
+				MaxUnmonitorPercent: 9},
+			list:        map[canon.Type][]int{canon.Manga: join(span(1, 5), span(7, 11))},
+			episodes:    testEpisodes(11),
+			wantRefused: 1,
+			wantRefusal: "6",
+			wantStrict:  true,
+		},
+		{
+			name: "the same share within a higher custom limit",
+			cfg: config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict,
+				MaxUnmonitorPercent: 10},
+			list:       map[canon.Type][]int{canon.Manga: join(span(1, 5), span(7, 11))},
+			episodes:   testEpisodes(11),
+			want:       []int{6},
+			wantStrict: true,
+		},
+		{
+			name: "strict leaves episodes before the cutoff and after the last canon episode",
+			cfg: config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict,
+				CutoffEpisode: 5},
+			list:       map[canon.Type][]int{canon.Manga: join(span(1, 9), span(11, 15))},
+			episodes:   testEpisodes(20),
+			want:       []int{10},
+			wantStrict: true,
+		},
+		{
+			name:       "strict skips episodes that are not monitored",
+			cfg:        config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict},
+			list:       map[canon.Type][]int{canon.Manga: join(span(1, 9), span(11, 20))},
+			episodes:   testEpisodes(20, 10),
+			wantStrict: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := BuildPlan(tt.cfg, testList(tt.list), testSeries, tt.episodes)
+			if plan == nil {
+				t.Fatalf("BuildPlan() returned no plan, error = %v", err)
+			}
+			if tt.wantRefused > 0 {
+				if !errors.Is(err, ErrUnmonitorThresholdExceeded) {
+					t.Fatalf("BuildPlan() error = %v, want ErrUnmonitorThresholdExceeded", err)
+				}
+			} else if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+
+			if got := episodeNumbers(plan.Unmonitor); !reflect.DeepEqual(got, append([]int{}, tt.want...)) {
+				t.Errorf("Unmonitor = %v, want %v", got, tt.want)
+			}
+			for number, want := range tt.wantReasons {
+				if got := reasons(plan.Unmonitor)[number]; got != want {
+					t.Errorf("reason of %d = %q, want %q", number, got, want)
+				}
+			}
+			for _, ep := range plan.Unmonitor {
+				if ep.EpisodeID != 100+ep.Number || !ep.WasMonitored {
+					t.Errorf("unmonitor entry %+v does not match its Sonarr episode", ep)
+				}
+			}
+
+			if (plan.Strict != nil) != tt.wantStrict {
+				t.Fatalf("Strict = %+v, want set: %t", plan.Strict, tt.wantStrict)
+			}
+			if plan.Strict == nil {
+				return
+			}
+			if plan.Strict.Refused != tt.wantRefused || plan.Strict.RefusedEpisodes != tt.wantRefusal {
+				t.Errorf("Strict refused %d (%q), want %d (%q)",
+					plan.Strict.Refused, plan.Strict.RefusedEpisodes, tt.wantRefused, tt.wantRefusal)
+			}
+			if plan.Strict.ConsideredCount != len(tt.episodes) {
+				t.Errorf("Strict.ConsideredCount = %d, want %d", plan.Strict.ConsideredCount, len(tt.episodes))
+			}
+		})
+	}
+}
+
+func TestBuildPlan(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          config.AnimeConfig
+		list         map[canon.Type][]int
+		titles       map[int]string // canon titles, by AnimeFillerList number
+		seriesType   string
+		episodes     []sonarr.Episode
+		wantMonitor  []int
+		wantReasons  map[int]string
+		wantSearch   []int
+		wantAlready  int
+		wantCanon    int
+		wantNotFound []int
+		wantUnmapped []int
+		wantTitles   map[int]string // planned titles, by Sonarr number
+		wantWarnings int
+	}{
+		{
+			name:        "monitors selected canon episodes",
+			cfg:         config.AnimeConfig{SonarrTitle: "One Piece"},
+			list:        map[canon.Type][]int{canon.Manga: span(1, 5), canon.Anime: []int{6}, canon.Filler: []int{7, 8}},
+			episodes:    testEpisodes(10, 3, 6, 7),
+			wantMonitor: []int{3, 6},
+			wantReasons: map[int]string{3: "manga canon", 6: "anime canon"},
+			wantAlready: 4,
+			wantCanon:   6,
+		},
+		{
+			name:        "searches newly monitored episodes",
+			cfg:         config.AnimeConfig{SonarrTitle: "One Piece", SearchEnabled: true},
+			list:        map[canon.Type][]int{canon.Manga: span(1, 5)},
+			episodes:    testEpisodes(10, 2, 4),
+			wantMonitor: []int{2, 4},
+			wantSearch:  []int{2, 4},
+			wantAlready: 3,
+			wantCanon:   5,
+		},
+		{
+			name:        "only selected types",
+			cfg:         config.AnimeConfig{SonarrTitle: "One Piece", IncludeCanonTypes: []string{"mixed"}},
+			list:        map[canon.Type][]int{canon.Manga: span(1, 3), canon.Mixed: []int{4}},
+			episodes:    testEpisodes(5, 1, 4),
+			wantMonitor: []int{4},
+			wantReasons: map[int]string{4: "mixed canon/filler"},
+			wantCanon:   1,
+		},
+		{
+			name:        "cutoff",
+			cfg:         config.AnimeConfig{SonarrTitle: "One Piece", CutoffEpisode: 4},
+			list:        map[canon.Type][]int{canon.Manga: span(1, 6)},
+			episodes:    testEpisodes(10, 2, 5),
+			wantMonitor: []int{5},
+			wantAlready: 2,
+			wantCanon:   3,
+		},
+		{
+			name:         "episodes missing in Sonarr",
+			cfg:          config.AnimeConfig{SonarrTitle: "One Piece"},
+			list:         map[canon.Type][]int{canon.Manga: span(1, 12)},
+			episodes:     testEpisodes(10),
+			wantAlready:  10,
+			wantCanon:    12,
+			wantNotFound: []int{11, 12},
+		},
+		{
+			name: "episode mapping",
+			cfg: config.AnimeConfig{SonarrTitle: "One Piece",
+				EpisodeMapping: config.EpisodeMapping{Offset: -1}},
+			list:         map[canon.Type][]int{canon.Manga: span(1, 5)},
+			titles:       map[int]string{3: "Morgan versus Luffy"},
+			episodes:     testEpisodes(10, 1, 2, 3, 4),
+			wantMonitor:  []int{1, 2, 3, 4},
+			wantCanon:    5,
+			wantUnmapped: []int{1},
+			wantTitles:   map[int]string{2: "Morgan versus Luffy"},
+		},
+		{
+			name:        "an episode in two categories takes the first type",
+			cfg:         config.AnimeConfig{SonarrTitle: "One Piece", IncludeCanonTypes: []string{"manga", "mixed", "anime"}},
+			list:        map[canon.Type][]int{canon.Filler: span(1, 4), canon.Anime: []int{2, 3}, canon.Manga: []int{3}, canon.Mixed: []int{4}},
+			episodes:    testEpisodes(4, 1, 2, 3, 4),
+			wantMonitor: []int{2, 3, 4},
+			wantReasons: map[int]string{2: "anime canon", 3: "manga canon", 4: "mixed canon/filler"},
+			wantCanon:   3,
+		},
+		{
+			name:         "absolute numbers on a series not typed anime",
+			cfg:          config.AnimeConfig{SonarrTitle: "One Piece"},
+			list:         map[canon.Type][]int{canon.Manga: span(1, 2)},
+			seriesType:   "standard",
+			episodes:     testEpisodes(2),
+			wantAlready:  2,
+			wantCanon:    2,
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := testList(tt.list)
+			for number, title := range tt.titles {
+				list.Details[number] = canon.Episode{Number: number, Title: title}
+			}
+			series := testSeries
+			if tt.seriesType != "" {
+				series.SeriesType = tt.seriesType
+			}
+			// Maps are iterated in random order, so repeat to catch plans
+			// that depend on it.
+			for i := 0; i < 20; i++ {
+				plan, err := BuildPlan(tt.cfg, list, series, tt.episodes)
+				if err != nil {
+					t.Fatalf("BuildPlan() error = %v", err)
+				}
+				if got := episodeNumbers(plan.Monitor); !reflect.DeepEqual(got, append([]int{}, tt.wantMonitor...)) {
+					t.Fatalf("Monitor = %v, want %v", got, tt.wantMonitor)
+				}
+				for number, want := range tt.wantReasons {
+					if got := reasons(plan.Monitor)[number]; got != want {
+						t.Fatalf("reason of %d = %q, want %q", number, got, want)
+					}
+				}
+				for _, ep := range plan.Monitor {
+					if want := tt.wantTitles[ep.Number]; ep.Title != want {
+						t.Fatalf("title of %d = %q, want %q", ep.Number, ep.Title, want)
+					}
+				}
+				if got := episodeNumbers(plan.Search); !reflect.DeepEqual(got, append([]int{}, tt.wantSearch...)) {
+					t.Fatalf("Search = %v, want %v", got, tt.wantSearch)
+				}
+				for _, ep := range plan.Search {
+					if ep.Reason != "newly monitored" {
+						t.Fatalf("search reason of %d = %q", ep.Number, ep.Reason)
+					}
+				}
+				if plan.AlreadyMonitored != tt.wantAlready || plan.CanonCount != tt.wantCanon {
+					t.Fatalf("AlreadyMonitored, CanonCount = %d, %d, want %d, %d",
+						plan.AlreadyMonitored, plan.CanonCount, tt.wantAlready, tt.wantCanon)
+				}
+				if !reflect.DeepEqual(plan.NotFound, tt.wantNotFound) || !reflect.DeepEqual(plan.UnmappedEpisodes, tt.wantUnmapped) {
+					t.Fatalf("NotFound, UnmappedEpisodes = %v, %v, want %v, %v",
+						plan.NotFound, plan.UnmappedEpisodes, tt.wantNotFound, tt.wantUnmapped)
+				}
+				if len(plan.Warnings) != tt.wantWarnings {
+					t.Fatalf("Warnings = %v, want %d", plan.Warnings, tt.wantWarnings)
+				}
+				if len(plan.Unmonitor) > 0 || plan.Strict != nil {
+					t.Fatalf("standard mode planned to unmonitor %v", episodeNumbers(plan.Unmonitor))
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPlanInvalidConfig(t *testing.T) {
+	for _, cfg := range []config.AnimeConfig{
+		{SonarrTitle: "One Piece", MatchBy: "tvdb"},
+		{SonarrTitle: "One Piece", EpisodeMapping: config.EpisodeMapping{
+			Ranges: []config.EpisodeMappingRange{{FillerList: "1-2", Sonarr: "1"}}}},
+	} {
+		plan, err := BuildPlan(cfg, testList(nil), testSeries, testEpisodes(2))
+		if plan != nil || err == nil {
+			t.Errorf("BuildPlan(%+v) = %v, %v, want an error", cfg, plan, err)
+		}
+	}
+}
@@ -1,163 +1,287 @@
 package processor
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"log"
-	"sort"
-	"strconv"
-	"strings"
+	"log/slog"
 
+	"kotei/internal/canon"
 	"kotei/internal/config"
-	"kotei/internal/fillerlist"
+	"kotei/internal/logging"
+	"kotei/internal/metrics"
 	"kotei/internal/sonarr"
 	"kotei/internal/util"
 )
 
-var procNilLogger = log.New(io.Discard, "", 0)
+var ErrUnmonitorThresholdExceeded = errors.New("unmonitor safety threshold exceeded")
 
-func ProcessAnime(cfg config.AnimeConfig, sClient *sonarr.Client, dryRun bool, isQuietableRun bool) (bool, error, bool) {
-	actionTaken := false
-	var processingError error
+var (
+	sonarrTag    = slog.String(logging.ComponentKey, "sonarr")
+	fillerTag    = slog.String(logging.ComponentKey, "filler")
+	mappingTag   = slog.String(logging.ComponentKey, "mapping")
+	processorTag = slog.String(logging.ComponentKey, "processor")
+)
+
+// Outcome is what ProcessAnime did for one anime entry. The episode lists
+// hold the changes Sonarr accepted, or those a dry run would have made.
+type Outcome struct {
+	SeriesID    int
+	SeriesTitle string
+	SeriesSlug  string
+	ActionTaken bool
+	Monitored   []PlannedEpisode
+	Unmonitored []PlannedEpisode
+	Searched    []PlannedEpisode
+	// Logged is set when the entry logged its own heading.
+	Logged bool
+}
+
+// ProcessAnime syncs one anime entry. seriesIndex is the run's shared Sonarr
+// library snapshot; when nil the library is fetched for this entry alone.
+// Records are logged to logger with an "anime" attribute; on quietable runs
+// only actions and problems are logged.
+func ProcessAnime(ctx context.Context, logger *slog.Logger, cfg config.AnimeConfig, sClient *sonarr.Client, seriesIndex *sonarr.SeriesIndex, dryRun bool, isQuietableRun bool) (Outcome, error) {
+	logger = logging.OrDiscard(logger).With("anime", cfg.DisplayName())
 	didLogOwnLines := false
 
-	var sonarrOriginalLogger *log.Logger
+	sonarrOriginalLogger := sClient.GetLogger()
 	if isQuietableRun {
-		sonarrOriginalLogger = sClient.GetLogger()
 		sClient.SetLogger(sonarr.NilLogger)
-		defer sClient.SetLogger(sonarrOriginalLogger)
+	} else {
+		sClient.SetLogger(logger)
 	}
+	defer sClient.SetLogger(sonarrOriginalLogger)
 
 	printHeaderOnce := func() {
 		if !didLogOwnLines {
-			log.Println()
-			log.Printf("  %s%s", util.BlueBold("Processing: "), cfg.SonarrTitle)
+			logging.Heading(logger, "Processing: "+cfg.DisplayName())
 			didLogOwnLines = true
 		}
 	}
 
-	logOwnLine := func(forcePrint bool, format string, args ...interface{}) {
-		if !isQuietableRun || forcePrint {
-			printHeaderOnce()
-			log.Printf(format, args...)
-		}
+	out := &animeLogger{logger: logger, quiet: isQuietableRun, header: printHeaderOnce}
+	if !isQuietableRun {
+		printHeaderOnce()
 	}
 
-	if cfg.FillerListTitle == "" || cfg.SonarrTitle == "" {
-		errMsg := fmt.Sprintf("Invalid config for %s: missing title or sonarr_title.", cfg.SonarrTitle)
-		logOwnLine(true, "  %s %s", util.RedBold("!!! ERROR"), errMsg)
-		return false, errors.New("invalid anime configuration entry"), didLogOwnLines
+	if cfg.SonarrTitle == "" && cfg.TvdbID == 0 && cfg.SonarrID == 0 {
+		out.log(true, slog.LevelError, "Invalid config: missing sonarr_title, tvdb_id or sonarr_id", processorTag)
+		return Outcome{Logged: didLogOwnLines}, errors.New("invalid anime configuration entry")
 	}
 
-	var flLogger *log.Logger
+	var flLogger *slog.Logger
 	if !isQuietableRun {
-		flLogger = log.Default()
+		flLogger = logger
 	} else {
-		flLogger = fillerlist.NilLogger
+		flLogger = canon.NilLogger
 	}
 
-	mangaEps, animeEps, mixedEps, err := fillerlist.GetCategorizedCanonEpisodes(cfg.FillerListTitle, cfg.IncludeCanonTypes, flLogger)
+	plan, err := planAnime(ctx, cfg, sClient, seriesIndex, flLogger, out)
+	if plan == nil {
+		return Outcome{Logged: didLogOwnLines}, err
+	}
+	processingError := err
+
+	outcome, applyErr := applyPlan(ctx, plan, sClient, dryRun, cfg.SearchEnabled, out.with("sonarr_series_id", plan.SeriesID))
+	if applyErr != nil && processingError == nil {
+		processingError = applyErr
+	}
+	outcome.Logged = didLogOwnLines
+
+	return outcome, processingError
+}
+
+// PlanAnime fetches the canon list and Sonarr state for one anime entry and
+// returns the resulting plan without changing anything in Sonarr. Progress is
+// logged to logger.
+func PlanAnime(ctx context.Context, logger *slog.Logger, cfg config.AnimeConfig, sClient *sonarr.Client, seriesIndex *sonarr.SeriesIndex) (*Plan, error) {
+	logger = logging.OrDiscard(logger).With("anime", cfg.DisplayName())
+	logging.Heading(logger, "Planning: "+cfg.DisplayName())
+	return planAnime(ctx, cfg, sClient, seriesIndex, logger, &animeLogger{logger: logger})
+}
+
+// ApplyPlan executes a previously built or saved plan exactly as recorded.
+func ApplyPlan(ctx context.Context, logger *slog.Logger, plan *Plan, sClient *sonarr.Client, dryRun bool) (Outcome, error) {
+	logger = logging.OrDiscard(logger).With("anime", plan.Anime, "sonarr_series_id", plan.SeriesID)
+	logging.Heading(logger, "Applying: "+plan.Anime)
+	return applyPlan(ctx, plan, sClient, dryRun, len(plan.Search) > 0, &animeLogger{logger: logger})
+}
+
+// animeLogger logs the progress of one anime entry. On quiet runs only
+// records logged with force are written, and the first written record is
+// preceded by the entry's heading.
+type animeLogger struct {
+	logger *slog.Logger
+	quiet  bool
+	header func()
+}
+
+func (l *animeLogger) log(force bool, level slog.Level, msg string, args ...any) {
+	if l.quiet && !force {
+		return
+	}
+	if l.header != nil {
+		l.header()
+	}
+	l.logger.Log(context.Background(), level, msg, args...)
+}
+
+func (l *animeLogger) with(args ...any) *animeLogger {
+	return &animeLogger{logger: l.logger.With(args...), quiet: l.quiet, header: l.header}
+}
+
+func planAnime(ctx context.Context, cfg config.AnimeConfig, sClient *sonarr.Client, seriesIndex *sonarr.SeriesIndex, flLogger *slog.Logger, out *animeLogger) (*Plan, error) {
+	source, err := canon.ForAnime(cfg)
 	if err != nil {
-		logOwnLine(true, "  %s Error from GetCategorizedCanonEpisodes for %s: %v", util.RedBold("!!! ERROR [FILLER]"), cfg.FillerListTitle, err)
-		return false, err, didLogOwnLines
+		out.log(true, slog.LevelError, "Invalid canon source", processorTag, "error", err)
+		return nil, err
 	}
 
-	includeTypes := cfg.IncludeCanonTypes
-	if len(includeTypes) == 0 {
-		includeTypes = []string{"manga", "anime", "mixed"}
+	episodeList, err := source.Fetch(ctx, cfg, flLogger)
+	if err != nil {
+		out.log(true, slog.LevelError, "Error fetching canon episodes", fillerTag, "source", source.Name(), "error", err)
+		return nil, err
 	}
-	combinedEpisodesMap := make(map[int]bool)
-	includeMap := make(map[string]bool)
-	for _, t := range includeTypes {
-		includeMap[strings.ToLower(strings.TrimSpace(t))] = true
+	for _, t := range []canon.Type{canon.Manga, canon.Mixed, canon.Anime, canon.Filler} {
+		metrics.CanonEpisodes(cfg.DisplayName(), string(t), len(episodeList.Categories[t]))
 	}
-	if includeMap["manga"] {
-		util.AddEpisodesToMap(combinedEpisodesMap, mangaEps)
+
+	seriesQuery := sonarr.SeriesQuery{Title: cfg.SonarrTitle, TvdbID: cfg.TvdbID, SonarrID: cfg.SonarrID}
+	var sonarrSeries sonarr.Series
+	if seriesIndex != nil {
+		sonarrSeries, err = sClient.LookupSeries(seriesIndex, seriesQuery)
+	} else {
+		sonarrSeries, err = sClient.GetSeries(ctx, seriesQuery)
 	}
-	if includeMap["anime"] {
-		util.AddEpisodesToMap(combinedEpisodesMap, animeEps)
+	if err != nil {
+		out.log(true, slog.LevelError, "Error obtaining Sonarr series", processorTag, "error", err)
+		return nil, err
 	}
-	if includeMap["mixed"] {
-		util.AddEpisodesToMap(combinedEpisodesMap, mixedEps)
+	out = out.with("sonarr_series_id", sonarrSeries.ID)
+
+	sonarrEpisodes, err := sClient.GetSeriesEpisodes(ctx, sonarrSeries.ID)
+	if err != nil {
+		out.log(true, slog.LevelError, "Error fetching Sonarr episodes", processorTag, "error", err)
+		return nil, err
 	}
 
-	episodesToProcess := []int{}
-	for ep := range combinedEpisodesMap {
-		if ep >= cfg.CutoffEpisode {
-			episodesToProcess = append(episodesToProcess, ep)
-		}
+	plan, err := BuildPlan(cfg, episodeList, sonarrSeries, sonarrEpisodes)
+	if plan == nil {
+		out.log(true, slog.LevelError, "Invalid config", processorTag, "error", err)
+		return nil, err
 	}
 
-	if len(episodesToProcess) == 0 {
-		var consideredTypes []string
-		if includeMap["manga"] {
-			consideredTypes = append(consideredTypes, "manga")
-		}
-		if includeMap["mixed"] {
-			consideredTypes = append(consideredTypes, "mixed")
-		}
-		if includeMap["anime"] {
-			consideredTypes = append(consideredTypes, "anime")
-		}
-		if len(consideredTypes) == 0 {
-			consideredTypes = append(consideredTypes, "configured")
-		}
-		logOwnLine(false, "  %s No relevant episodes from %v types (cutoff >= %d).", util.Green("[Processor]"), consideredTypes, cfg.CutoffEpisode)
+	if plan.CanonCount == 0 {
+		out.log(false, slog.LevelInfo, "No relevant episodes", processorTag, "types", fmt.Sprint(plan.IncludeTypes), "cutoff", cfg.CutoffEpisode)
 	} else {
-		sort.Ints(episodesToProcess)
-		logOwnLine(false, "  %s Canon episodes (%s >= %s): %s found.",
-			util.Purple("[FILLER]"), util.Cyan("cutoff"), util.Cyan(strconv.Itoa(cfg.CutoffEpisode)),
-			util.GreenBold(fmt.Sprintf("%d", len(episodesToProcess))))
+		out.log(false, slog.LevelInfo, "Canon episodes found", fillerTag, "canon", plan.CanonCount, "cutoff", cfg.CutoffEpisode)
+	}
+	if len(plan.UnmappedEpisodes) > 0 {
+		out.log(false, slog.LevelWarn, "Episodes have no Sonarr equivalent", mappingTag,
+			"count", len(plan.UnmappedEpisodes), "episodes", util.FormatEpisodeRanges(plan.UnmappedEpisodes))
+	}
+	for _, warning := range plan.Warnings {
+		out.log(true, slog.LevelWarn, warning, processorTag)
 	}
 
-	sonarrSeriesID, err := sClient.GetSeriesID(cfg.SonarrTitle)
-	if err != nil {
-		logOwnLine(true, "  %s Processor: Error obtaining Sonarr Series ID for '%s': %v", util.RedBold("!!! ERROR"), cfg.SonarrTitle, err)
-		return false, err, didLogOwnLines
+	if len(plan.Monitor) > 0 || plan.AlreadyMonitored > 0 || len(plan.NotFound) > 0 {
+		args := []any{sonarrTag, "new", len(plan.Monitor), "already_monitored", plan.AlreadyMonitored}
+		if len(plan.NotFound) > 0 {
+			args = append(args, "not_found", len(plan.NotFound))
+			if plan.AlreadyMonitored == 0 && len(plan.Monitor) == 0 && len(sonarrEpisodes) > 0 {
+				args = append(args, "hint", fmt.Sprintf("none matched by %s number, try another match_by", plan.MatchStrategy))
+			}
+		}
+		out.log(false, slog.LevelInfo, "Episodes to monitor", args...)
 	}
 
-	sonarrIDsToNewlyMonitor, err := sClient.GetEpisodeIDsToNewlyMonitor(sonarrSeriesID, episodesToProcess)
-	if err != nil {
-		logOwnLine(true, "  %s Processor: Error identifying episodes to monitor for '%s': %v", util.RedBold("!!! ERROR"), cfg.SonarrTitle, err)
-		return false, err, didLogOwnLines
+	if cfg.IsStrict() && plan.Strict == nil {
+		out.log(false, slog.LevelInfo, "Strict sync: skipped (no canon episodes to compare against)", sonarrTag)
 	}
+	if plan.Strict != nil && plan.Strict.Refused > 0 {
+		out.log(true, slog.LevelError, "Strict sync: refusing to unmonitor episodes", sonarrTag,
+			"refused", plan.Strict.Refused, "considered", plan.Strict.ConsideredCount,
+			"limit_percent", plan.Strict.LimitPercent, "episodes", plan.Strict.RefusedEpisodes)
+	}
+	return plan, err
+}
 
-	if len(sonarrIDsToNewlyMonitor) > 0 {
-		actionTaken = true
-		logOwnLine(true, "  %s Identified %d new episode(s) to monitor.", util.Cyan("[SONARR]"), len(sonarrIDsToNewlyMonitor))
-		err = sClient.MonitorEpisodes(sonarrIDsToNewlyMonitor, dryRun)
-		if err != nil {
-			logOwnLine(true, "  %s Processor: Error during Sonarr MonitorEpisodes call for '%s': %v", util.RedBold("!!! ERROR"), cfg.SonarrTitle, err)
-			processingError = err
+func applyPlan(ctx context.Context, plan *Plan, sClient *sonarr.Client, dryRun bool, searchEnabled bool, out *animeLogger) (Outcome, error) {
+	outcome := Outcome{SeriesID: plan.SeriesID, SeriesTitle: plan.SeriesTitle, SeriesSlug: plan.SeriesSlug}
+	var processingError error
+
+	if len(plan.Monitor) > 0 {
+		outcome.ActionTaken = true
+		out.log(true, slog.LevelInfo, "Identified new episodes to monitor", sonarrTag, "count", len(plan.Monitor))
+		if dryRun {
+			logPlannedEpisodes(plan.Monitor, out)
 		}
-	} else {
-		if len(episodesToProcess) > 0 {
-			logOwnLine(false, "  %s Monitoring: No update needed (all relevant canon episodes already monitored).", util.Cyan("[SONARR]"))
-		} else if !isQuietableRun {
-			if len(combinedEpisodesMap) > 0 {
-				logOwnLine(false, "  %s Monitoring: No update needed (no episodes to process from canon list).", util.Cyan("[SONARR]"))
+		if err := sClient.MonitorEpisodes(ctx, episodeIDs(plan.Monitor), dryRun); err != nil {
+			out.log(true, slog.LevelError, "Sonarr MonitorEpisodes call failed", processorTag, "error", err)
+			processingError = err
+		} else {
+			outcome.Monitored = plan.Monitor
+			if !dryRun {
+				metrics.EpisodesChanged(plan.Anime, string(ActionMonitor), len(plan.Monitor))
 			}
 		}
+	} else if plan.CanonCount > 0 {
+		out.log(false, slog.LevelInfo, "Monitoring: no update needed (all relevant canon episodes already monitored)", sonarrTag)
 	}
 
-	if cfg.SearchEnabled {
-		if len(sonarrIDsToNewlyMonitor) > 0 {
-			actionTaken = true
-			logOwnLine(true, "  %s Queuing search for %d newly monitored episode(s).", util.CyanBold("[SONARR]"), len(sonarrIDsToNewlyMonitor))
-			err = sClient.SearchEpisodes(sonarrIDsToNewlyMonitor, dryRun)
-			if err != nil {
-				logOwnLine(true, "  %s Processor: Error during Sonarr SearchEpisodes call for '%s': %v", util.RedBold("!!! ERROR"), cfg.SonarrTitle, err)
+	if searchEnabled {
+		if len(plan.Search) > 0 {
+			outcome.ActionTaken = true
+			out.log(true, slog.LevelInfo, "Queuing search for newly monitored episodes", sonarrTag, "count", len(plan.Search))
+			if err := sClient.SearchEpisodes(ctx, episodeIDs(plan.Search), dryRun); err != nil {
+				out.log(true, slog.LevelError, "Sonarr SearchEpisodes call failed", processorTag, "error", err)
 				if processingError == nil {
 					processingError = err
 				}
+			} else {
+				outcome.Searched = plan.Search
+				if !dryRun {
+					metrics.EpisodesChanged(plan.Anime, string(ActionSearch), len(plan.Search))
+				}
 			}
 		} else {
-			logOwnLine(false, "  %s Search: Skipped (no new episodes were monitored to trigger search).", util.Cyan("[SONARR]"))
+			out.log(false, slog.LevelInfo, "Search: skipped (no new episodes were monitored to trigger search)", sonarrTag)
 		}
 	} else {
-		logOwnLine(false, "  %s Search: Disabled.", util.Cyan("[SONARR]"))
+		out.log(false, slog.LevelInfo, "Search: disabled", sonarrTag)
+	}
+
+	if plan.Strict != nil && plan.Strict.Refused == 0 {
+		if len(plan.Unmonitor) == 0 {
+			out.log(false, slog.LevelInfo, "Strict sync: no update needed (no monitored non-canon episodes)", sonarrTag)
+		} else {
+			outcome.ActionTaken = true
+			out.log(true, slog.LevelInfo, "Identified non-canon episodes to unmonitor", sonarrTag,
+				"count", len(plan.Unmonitor), "episodes", util.FormatEpisodeRanges(episodeNumbers(plan.Unmonitor)))
+			if dryRun {
+				logPlannedEpisodes(plan.Unmonitor, out)
+			}
+			if err := sClient.UnmonitorEpisodes(ctx, episodeIDs(plan.Unmonitor), dryRun); err != nil {
+				out.log(true, slog.LevelError, "Sonarr UnmonitorEpisodes call failed", processorTag, "error", err)
+				if processingError == nil {
+					processingError = err
+				}
+			} else {
+				outcome.Unmonitored = plan.Unmonitor
+				if !dryRun {
+					metrics.EpisodesChanged(plan.Anime, string(ActionUnmonitor), len(plan.Unmonitor))
+				}
+			}
+		}
 	}
 
-	return actionTaken, processingError, didLogOwnLines
+	return outcome, processingError
+}
+
+func logPlannedEpisodes(episodes []PlannedEpisode, out *animeLogger) {
+	for _, ep := range episodes {
+		out.log(true, slog.LevelInfo, fmt.Sprintf("  - #%d S%02dE%02d %s", ep.Number, ep.SeasonNumber, ep.EpisodeNumber, ep.Title),
+			"episode_id", ep.EpisodeID, "reason", ep.Reason)
+	}
 }
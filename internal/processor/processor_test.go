@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"kotei/internal/canon"
+	"kotei/internal/config"
+	"kotei/internal/logging"
+	"kotei/internal/sonarr"
+)
+
+// fakeSonarr records the monitor updates sent to it.
+type fakeSonarr struct {
+	mu       sync.Mutex
+	requests []string
+	updates  []sonarr.EpisodeMonitorRequest
+}
+
+func (f *fakeSonarr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if r.Method == http.MethodPut && r.URL.Path == "/api/v3/episode/monitor" {
+		var update sonarr.EpisodeMonitorRequest
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.updates = append(f.updates, update)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *sonarr.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	var cfg config.Config
+	cfg.Sonarr.BaseURL = server.URL
+	cfg.Sonarr.APIPath = "/api/v3"
+	cfg.Sonarr.TimeoutSeconds = 5
+	return sonarr.NewClient(cfg, logging.Discard())
+}
+
+func TestApplyPlanUnmonitor(t *testing.T) {
+	cfg := config.AnimeConfig{SonarrTitle: "One Piece", SyncMode: config.SyncModeStrict}
+	list := testList(map[canon.Type][]int{canon.Manga: join(span(1, 5), span(8, 20)), canon.Filler: []int{6, 7}})
+	plan, err := BuildPlan(cfg, list, testSeries, testEpisodes(20))
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		fake := &fakeSonarr{}
+		var logs bytes.Buffer
+		logger := slog.New(logging.NewTextHandler(&logs, slog.LevelInfo, false))
+		outcome, err := ApplyPlan(context.Background(), logger, plan, newTestClient(t, fake), true)
+		if err != nil {
+			t.Fatalf("ApplyPlan() error = %v", err)
+		}
+		if len(fake.requests) > 0 {
+			t.Errorf("dry run sent %v", fake.requests)
+		}
+		if got := episodeNumbers(outcome.Unmonitored); !reflect.DeepEqual(got, []int{6, 7}) {
+			t.Errorf("Unmonitored = %v, want [6 7]", got)
+		}
+		for _, want := range []string{
+			"Identified non-canon episodes to unmonitor",
+			"count=2 episodes=6-7",
+			"- #6 S01E06", "episode_id=106 reason=filler",
+			"- #7 S01E07", "episode_id=107 reason=filler",
+		} {
+			if !strings.Contains(logs.String(), want) {
+				t.Errorf("dry run output lacks %q:\n%s", want, logs.String())
+			}
+		}
+	})
+
+	t.Run("real run", func(t *testing.T) {
+		fake := &fakeSonarr{}
+		outcome, err := ApplyPlan(context.Background(), logging.Discard(), plan, newTestClient(t, fake), false)
+		if err != nil {
+			t.Fatalf("ApplyPlan() error = %v", err)
+		}
+		want := []sonarr.EpisodeMonitorRequest{{EpisodeIDs: []int{106, 107}, Monitored: false}}
+		if !reflect.DeepEqual(fake.updates, want) {
+			t.Errorf("monitor updates = %+v, want %+v", fake.updates, want)
+		}
+		if !outcome.ActionTaken || len(outcome.Unmonitored) != 2 {
+			t.Errorf("outcome = %+v, want two unmonitored episodes", outcome)
+		}
+	})
+
+	t.Run("refused plan", func(t *testing.T) {
+		cfg := cfg
+		cfg.MaxUnmonitorPercent = 5
+		refused, err := BuildPlan(cfg, list, testSeries, testEpisodes(20))
+		if refused == nil || err == nil {
+			t.Fatalf("BuildPlan() = %v, %v, want a refused plan", refused, err)
+		}
+		fake := &fakeSonarr{}
+		if _, err := ApplyPlan(context.Background(), logging.Discard(), refused, newTestClient(t, fake), false); err != nil {
+			t.Fatalf("ApplyPlan() error = %v", err)
+		}
+		if len(fake.requests) > 0 {
+			t.Errorf("refused plan sent %v", fake.requests)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"strings"
+
+	"kotei/internal/canon"
+	"kotei/internal/config"
+	"kotei/internal/episodemap"
+	"kotei/internal/sonarr"
+)
+
+// ValidateConfig runs Config.Validate plus the per-anime checks that need the
+// canon, mapping and Sonarr packages, returning every problem found.
+func ValidateConfig(cfg config.Config) config.ValidationErrors {
+	errs := cfg.Validate()
+	for i, anime := range cfg.Animes {
+		source, err := canon.ForAnime(anime)
+		if err != nil {
+			errs.Add(config.AnimePath(i, "source"), "%v", err)
+		} else {
+			switch source.Name() {
+			case canon.DefaultSourceName:
+				if strings.TrimSpace(anime.FillerListTitle) == "" {
+					errs.Add(config.AnimePath(i, "title"), "is required for source '%s'", source.Name())
+				}
+			case canon.FileSourceName:
+				if strings.TrimSpace(anime.SourceFile) == "" {
+					errs.Add(config.AnimePath(i, "source_file"), "is required for source '%s'", source.Name())
+				}
+			}
+		}
+		if _, err := sonarr.ParseMatchStrategy(anime.MatchBy); err != nil {
+			errs.Add(config.AnimePath(i, "match_by"), "%v", err)
+		}
+		if _, err := episodemap.New(anime.EpisodeMapping); err != nil {
+			errs.Add(config.AnimePath(i, ""), "%v", err)
+		}
+	}
+	return errs
+}
@@ -1,14 +1,22 @@
 package scheduler
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"kotei/internal/canon"
 	"kotei/internal/config"
+	"kotei/internal/logging"
+	"kotei/internal/metrics"
 	"kotei/internal/processor"
 	"kotei/internal/sonarr"
 	"kotei/internal/util"
@@ -16,164 +24,563 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
-const scheduleTagText = "[SCHEDULE]"
+var scheduleTag = slog.String(logging.ComponentKey, "schedule")
 
-func runChecks(appConfig config.Config, sClient *sonarr.Client, dryRun bool, isScheduledRun bool) (int, bool) {
-	if len(appConfig.Animes) == 0 {
-		return 0, isScheduledRun
+var (
+	// ErrRunInProgress is returned by Trigger while another run is still going.
+	ErrRunInProgress = errors.New("a run is already in progress")
+	// ErrShuttingDown is returned by Trigger once shutdown has begun.
+	ErrShuttingDown = errors.New("shutting down")
+)
+
+// Notifier is told about every finished run, e.g. to send notifications.
+type Notifier interface {
+	RunFinished(ctx context.Context, stats RunStats)
+}
+
+// Recorder keeps every finished run, e.g. in the state store.
+type Recorder interface {
+	RecordRun(stats RunStats) error
+}
+
+// NewRunID returns a short random identifier that ties together the records
+// of one run.
+func NewRunID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Scheduler runs the configured anime entries, once or on the cron spec, and
+// remembers the outcome of the last run. Only one run happens at a time,
+// whether it was started by cron or by Trigger.
+//
+// Two contexts govern shutdown: once stopCtx is done no new run or anime
+// entry is started, and the entry in flight keeps workCtx until the shutdown
+// timeout has passed.
+//
+// Reload swaps the config, Sonarr client and cron entry while holding
+// running, so a run always sees one config from start to finish.
+type Scheduler struct {
+	logger *slog.Logger
+
+	cfgMu     sync.RWMutex
+	appConfig config.Config
+	sClient   *sonarr.Client
+	dryRun    bool
+	notifier  Notifier
+	recorder  Recorder
+	cron      *cron.Cron
+	// cronEntries maps each cron spec in use to its job.
+	cronEntries map[string]cron.EntryID
+
+	stopCtx context.Context
+	workCtx context.Context
+
+	running sync.Mutex
+
+	lastMu  sync.RWMutex
+	lastRun *RunStats
+}
+
+// New creates a scheduler that shuts down when ctx is done.
+func New(ctx context.Context, logger *slog.Logger, appConfig config.Config, sClient *sonarr.Client, dryRun bool) *Scheduler {
+	s := &Scheduler{
+		logger:    logging.OrDiscard(logger),
+		appConfig: appConfig,
+		sClient:   sClient,
+		dryRun:    dryRun,
+		stopCtx:   ctx,
+	}
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	s.workCtx = workCtx
+	timeout := time.Duration(appConfig.Schedule.ShutdownTimeoutSeconds) * time.Second
+	context.AfterFunc(ctx, func() {
+		time.AfterFunc(timeout, func() {
+			if s.isRunning() {
+				s.logger.Warn("Shutdown timeout reached, cancelling the run in progress", scheduleTag, "timeout", timeout.String())
+			}
+			cancelWork()
+		})
+	})
+	return s
+}
+
+func (s *Scheduler) isRunning() bool {
+	if s.running.TryLock() {
+		s.running.Unlock()
+		return false
+	}
+	return true
+}
+
+// current returns the config, Sonarr client and dry-run flag in effect.
+func (s *Scheduler) current() (config.Config, *sonarr.Client, bool) {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.appConfig, s.sClient, s.dryRun
+}
+
+// SetNotifier makes the scheduler report every finished run to notifier.
+func (s *Scheduler) SetNotifier(notifier Notifier) {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	s.notifier = notifier
+}
+
+// SetRecorder makes the scheduler record every finished run with recorder,
+// before notifying.
+func (s *Scheduler) SetRecorder(recorder Recorder) {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	s.recorder = recorder
+}
+
+// SonarrClient returns the Sonarr client in effect, which Reload replaces
+// when the Sonarr settings change.
+func (s *Scheduler) SonarrClient() *sonarr.Client {
+	_, sClient, _ := s.current()
+	return sClient
+}
+
+// LastRun returns the stats of the most recently finished run.
+func (s *Scheduler) LastRun() (RunStats, bool) {
+	s.lastMu.RLock()
+	defer s.lastMu.RUnlock()
+	if s.lastRun == nil {
+		return RunStats{}, false
+	}
+	return *s.lastRun, true
+}
+
+// Trigger starts a verbose run in the background, limited to the entry
+// matching only when it is not empty, and returns the new run's ID. It
+// returns ErrRunInProgress instead of queuing behind a running run.
+func (s *Scheduler) Trigger(only string) (string, error) {
+	if s.stopCtx.Err() != nil {
+		return "", ErrShuttingDown
+	}
+	if !s.running.TryLock() {
+		return "", ErrRunInProgress
+	}
+	appConfig, _, _ := s.current()
+	animes := appConfig.Animes
+	if only != "" {
+		var err error
+		if animes, err = config.FilterAnimes(animes, only); err != nil {
+			s.running.Unlock()
+			return "", err
+		}
+	}
+	runID := NewRunID()
+	go func() {
+		defer s.running.Unlock()
+		s.runChecks(runID, TriggerManual, animes, false)
+	}()
+	return runID, nil
+}
+
+// runChecks processes animes and records the run's stats. The caller holds
+// running.
+func (s *Scheduler) runChecks(runID string, trigger string, animes []config.AnimeConfig, isScheduledRun bool) (stats RunStats) {
+	_, sClient, dryRun := s.current()
+	stats = RunStats{
+		ID:        runID,
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Animes:    []AnimeResult{},
+	}
+	defer func() {
+		stats.FinishedAt = time.Now()
+		metrics.RunFinished(stats.Trigger, stats.Result(), stats.Duration(), stats.OK, stats.Skipped, stats.Failed)
+		s.lastMu.Lock()
+		s.lastRun = &stats
+		s.lastMu.Unlock()
+		s.cfgMu.RLock()
+		notifier, recorder := s.notifier, s.recorder
+		s.cfgMu.RUnlock()
+		if recorder != nil {
+			if err := recorder.RecordRun(stats); err != nil {
+				s.logger.Warn("Failed to record run in the state store", "run_id", stats.ID, "error", err)
+			}
+		}
+		if notifier != nil {
+			notifier.RunFinished(s.workCtx, stats)
+		}
+	}()
+
+	if len(animes) == 0 {
+		stats.AllQuiet = isScheduledRun
+		return stats
 	}
-	wasAllQuietOrNoOp := false
+	logger := s.logger.With("run_id", runID)
 	if !isScheduledRun {
-		log.Printf("%s Processing %d anime series...", util.Green("[INFO]"), len(appConfig.Animes))
+		logger.Info("Processing anime series...", "count", len(animes), "dry_run", dryRun, "trigger", trigger)
 	}
-	runErrorsEncountered, runHardFailuresCount, runSuccessCount, runSkippedNotFoundCount := 0, 0, 0, 0
 	anyAnimeHadActionOrErrorInRun := false
-	anyAnimeOutputtedLogs := false
-	for _, animeCfg := range appConfig.Animes {
-		animeActionTaken, processErr, animeDidLog := processor.ProcessAnime(animeCfg, sClient, dryRun, isScheduledRun)
-		if animeDidLog {
-			anyAnimeOutputtedLogs = true
+	seriesIndex, err := sClient.FetchSeriesIndex(s.workCtx)
+	if err != nil {
+		logger.Warn("Could not load Sonarr series list, falling back to per-anime lookups", "error", err)
+		seriesIndex = nil
+	}
+	for i, animeCfg := range animes {
+		if s.stopCtx.Err() != nil {
+			logger.Warn("Shutdown requested, skipping remaining anime entries", "remaining", len(animes)-i)
+			stats.Interrupted = true
+			break
 		}
+		stats.Processed++
+		outcome, processErr := processor.ProcessAnime(s.workCtx, logger, animeCfg, sClient, seriesIndex, dryRun, isScheduledRun)
+		animeActionTaken := outcome.ActionTaken
 		if animeActionTaken || processErr != nil {
 			anyAnimeHadActionOrErrorInRun = true
 		}
-		var statusPartString string
+		result := AnimeResult{
+			Anime:       animeCfg.DisplayName(),
+			Status:      AnimeStatusOK,
+			ActionTaken: animeActionTaken,
+			FinishedAt:  time.Now(),
+			SeriesID:    outcome.SeriesID,
+			SeriesTitle: outcome.SeriesTitle,
+			SeriesSlug:  outcome.SeriesSlug,
+			Monitored:   outcome.Monitored,
+			Unmonitored: outcome.Unmonitored,
+			Searched:    outcome.Searched,
+		}
+		var status string
+		level := slog.LevelInfo
 		printStatusLineForThisAnime := false
 		if processErr != nil {
-			runErrorsEncountered++
+			stats.Errors++
+			result.Error = processErr.Error()
 			printStatusLineForThisAnime = true
 			if errors.Is(processErr, sonarr.ErrSeriesNotFound) {
-				statusPartString = util.Yellow("[STATUS] SKIPPED (Not Found)")
-				runSkippedNotFoundCount++
+				status, level = "SKIPPED (Not Found)", slog.LevelWarn
+				result.Status = AnimeStatusNotFound
+				stats.Skipped++
+				metrics.SeriesNotFound(animeCfg.DisplayName())
 			} else {
-				statusPartString = util.RedBold("[STATUS] ERROR")
-				runHardFailuresCount++
+				status, level = "ERROR", slog.LevelError
+				result.Status = AnimeStatusError
+				stats.Failed++
 			}
 		} else {
-			runSuccessCount++
+			stats.OK++
 			if animeActionTaken {
-				statusPartString = util.GreenBold("[STATUS] OK (New actions taken)")
+				status = "OK (New actions taken)"
 				printStatusLineForThisAnime = true
 			} else if !isScheduledRun {
-				statusPartString = util.GreenBold("[STATUS] OK (No new actions)")
+				status = "OK (No new actions)"
 				printStatusLineForThisAnime = true
 			}
 		}
+		stats.Animes = append(stats.Animes, result)
 		if printStatusLineForThisAnime {
-			if !animeDidLog {
-				log.Println()
-				log.Printf("  %s%s", util.BlueBold("Processing: "), animeCfg.SonarrTitle)
+			animeLogger := logger.With("anime", animeCfg.DisplayName())
+			if !outcome.Logged {
+				logging.Heading(animeLogger, "Processing: "+animeCfg.DisplayName())
 			}
-			log.Printf("  %s", statusPartString)
-			anyAnimeOutputtedLogs = true
+			animeLogger.Log(context.Background(), level, "[STATUS] "+status)
 		}
 	}
-	if isScheduledRun && !anyAnimeHadActionOrErrorInRun && runErrorsEncountered == 0 {
-		wasAllQuietOrNoOp = true
-	} else {
-		wasAllQuietOrNoOp = false
-		if anyAnimeOutputtedLogs || !isScheduledRun {
-			log.Println()
-		}
-		var statsParts []string
-		statsParts = append(statsParts, "Processed: "+util.BlueBold(strconv.Itoa(len(appConfig.Animes))))
-		statsParts = append(statsParts, "OK: "+util.GreenBold(strconv.Itoa(runSuccessCount)))
-		if runSkippedNotFoundCount > 0 {
-			statsParts = append(statsParts, "Skipped: "+util.YellowBold(strconv.Itoa(runSkippedNotFoundCount)))
-		}
-		if runHardFailuresCount > 0 {
-			statsParts = append(statsParts, "Failed: "+util.RedBold(strconv.Itoa(runHardFailuresCount)))
-		}
-		otherIssues := runErrorsEncountered - runHardFailuresCount - runSkippedNotFoundCount
-		if otherIssues < 0 {
-			otherIssues = 0
+	if isScheduledRun && !anyAnimeHadActionOrErrorInRun && stats.Errors == 0 && !stats.Interrupted {
+		stats.AllQuiet = true
+		return stats
+	}
+
+	logging.Heading(logger, "[Run Stats]",
+		"processed", stats.Processed,
+		"ok", stats.OK,
+		"skipped", stats.Skipped,
+		"failed", stats.Failed)
+	if dryRun {
+		logger.Info("(Dry Run - No changes made)")
+	}
+	if stats.Failed > 0 {
+		logger.Error("Run completed with errors.")
+	} else if stats.Errors > 0 {
+		logger.Warn("Run completed with some non-critical issues or skips.")
+	} else if anyAnimeHadActionOrErrorInRun || !isScheduledRun {
+		logger.Info("Run completed successfully.")
+	}
+	return stats
+}
+
+// animesFor returns the entries of appConfig whose effective cron spec is
+// spec.
+func animesFor(appConfig config.Config, spec string) []config.AnimeConfig {
+	var animes []config.AnimeConfig
+	for _, animeCfg := range appConfig.Animes {
+		if animeCfg.CronSpec(appConfig.Schedule.CronSpec) == spec {
+			animes = append(animes, animeCfg)
 		}
-		if otherIssues > 0 {
-			statsParts = append(statsParts, util.Purple("Other Issues: ")+util.Purple(strconv.Itoa(otherIssues)))
+	}
+	return animes
+}
+
+// cronSpecs returns the distinct cron specs appConfig needs, the global one
+// first. The global spec is left out when every entry has its own schedule.
+func cronSpecs(appConfig config.Config) []string {
+	var specs []string
+	seen := make(map[string]bool)
+	if len(appConfig.Animes) == 0 {
+		specs = append(specs, strings.TrimSpace(appConfig.Schedule.CronSpec))
+	}
+	for _, animeCfg := range appConfig.Animes {
+		if spec := animeCfg.CronSpec(appConfig.Schedule.CronSpec); !seen[spec] {
+			seen[spec] = true
+			specs = append(specs, spec)
 		}
-		statsString := strings.Join(statsParts, " | ")
-		log.Printf("%s %s", util.Cyan("[Run Stats]"), statsString)
-		if dryRun {
-			if !anyAnimeOutputtedLogs && isScheduledRun {
-				log.Println()
+	}
+	return specs
+}
+
+// scheduleJobs registers one cron job per spec appConfig needs and removes
+// the previous ones. The caller holds cfgMu.
+func (s *Scheduler) scheduleJobs(appConfig config.Config) error {
+	entries := make(map[string]cron.EntryID)
+	for _, spec := range cronSpecs(appConfig) {
+		entryID, err := s.cron.AddFunc(spec, func() { s.scheduledRun(spec) })
+		if err != nil {
+			for _, added := range entries {
+				s.cron.Remove(added)
 			}
-			log.Printf("  %s", util.YellowBold("(Dry Run - No changes made)"))
-		}
-		if runHardFailuresCount > 0 {
-			log.Println(util.Red("  Run completed with errors."))
-		} else if runErrorsEncountered > 0 {
-			log.Println(util.Yellow("  Run completed with some non-critical issues or skips."))
-		} else if anyAnimeHadActionOrErrorInRun || !isScheduledRun {
-			log.Println(util.Green("  Run completed successfully."))
+			return fmt.Errorf("invalid cron spec '%s': %w", spec, err)
 		}
+		entries[spec] = entryID
+	}
+	for _, entryID := range s.cronEntries {
+		s.cron.Remove(entryID)
 	}
-	return runErrorsEncountered, wasAllQuietOrNoOp
+	s.cronEntries = entries
+	return nil
 }
 
-func Run(appConfig config.Config, sClient *sonarr.Client, dryRun bool) int {
-	cronSpec := appConfig.Schedule.CronSpec
-	schedulerTagColored := util.YellowBold(scheduleTagText)
-
-	jobFuncWrapper := func() {
-		runStartTime := time.Now()
-		errorsInRun, wasAllQuietOrNoOp := runChecks(appConfig, sClient, dryRun, true)
-
-		if wasAllQuietOrNoOp && errorsInRun == 0 {
-			dayWithSuffix := strconv.Itoa(runStartTime.Day()) + util.GetOrdinalSuffix(runStartTime.Day())
-			dateTimePart := fmt.Sprintf("%s %s %d at %s",
-				dayWithSuffix, runStartTime.Month().String(), runStartTime.Year(), runStartTime.Format("15:04"))
-			durationPart := fmt.Sprintf("took %s", time.Since(runStartTime).Round(time.Millisecond).String())
-			detailsInsideParentheses := util.Gray(fmt.Sprintf("%s, %s", dateTimePart, durationPart))
-
-			message := "All quiet."
-			if len(appConfig.Animes) == 0 {
-				message = "No anime configured."
-			} else if len(appConfig.Animes) == 1 {
-				message = fmt.Sprintf("1 series checked, all quiet.")
-			} else {
-				message = fmt.Sprintf("%d series checked, all quiet.", len(appConfig.Animes))
-			}
+// logNextRuns lists when each anime entry is checked next. The caller holds
+// cfgMu.
+func (s *Scheduler) logNextRuns(appConfig config.Config) {
+	logging.Heading(s.logger, "Next scheduled runs", scheduleTag)
+	for _, animeCfg := range appConfig.Animes {
+		spec := animeCfg.CronSpec(appConfig.Schedule.CronSpec)
+		next := s.cron.Entry(s.cronEntries[spec]).Next
+		s.logger.Info(animeCfg.DisplayName(), scheduleTag,
+			"cron", spec,
+			"next", next.Format("2006-01-02 15:04"))
+	}
+}
+
+// lockForScheduledRun takes running, waiting for the run in progress to
+// finish. It gives up and returns false once shutdown has begun.
+func (s *Scheduler) lockForScheduledRun(spec string) bool {
+	if s.running.TryLock() {
+		return true
+	}
+	s.logger.Info("Waiting for the run in progress to finish", scheduleTag, "cron", spec)
+	acquired := make(chan struct{})
+	go func() {
+		s.running.Lock()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		return true
+	case <-s.stopCtx.Done():
+		// Hand the lock back as soon as the waiting goroutine gets it.
+		go func() {
+			<-acquired
+			s.running.Unlock()
+		}()
+		return false
+	}
+}
+
+// scheduledRun is the cron job for the entries scheduled on spec. Jobs of
+// different specs that are due at the same time wait for each other, so no
+// entry misses its run; overlapping runs of the same job are skipped by
+// cron's SkipIfStillRunning.
+func (s *Scheduler) scheduledRun(spec string) {
+	if !s.lockForScheduledRun(spec) {
+		return
+	}
+	defer s.running.Unlock()
+	if s.stopCtx.Err() != nil {
+		return
+	}
 
-			log.Printf("%s %s %s%s%s",
-				schedulerTagColored,
-				message,
-				util.Gray("("),
-				detailsInsideParentheses,
-				util.Gray(")"))
+	appConfig, _, _ := s.current()
+	animes := animesFor(appConfig, spec)
+	runStartTime := time.Now()
+	stats := s.runChecks(NewRunID(), TriggerSchedule, animes, true)
+
+	if stats.AllQuiet && stats.Errors == 0 {
+		dayWithSuffix := strconv.Itoa(runStartTime.Day()) + util.GetOrdinalSuffix(runStartTime.Day())
+		dateTimePart := fmt.Sprintf("%s %s %d at %s",
+			dayWithSuffix, runStartTime.Month().String(), runStartTime.Year(), runStartTime.Format("15:04"))
+
+		message := "All quiet."
+		if len(animes) == 0 {
+			message = "No anime configured."
+		} else if len(animes) == 1 {
+			message = "1 series checked, all quiet."
 		} else {
-			log.Printf("\n%s ----- Scheduled Run Starting (%s) -----",
-				schedulerTagColored,
-				runStartTime.Format("2006-01-02 15:04:05"))
-
-			log.Printf("%s ----- Scheduled Run Finished (%s, Duration: %s) -----",
-				schedulerTagColored,
-				time.Now().Format("2006-01-02 15:04:05"),
-				time.Since(runStartTime).Round(time.Millisecond))
-			if errorsInRun > 0 {
-				log.Printf("%s   Note: Scheduled run completed with %s.", schedulerTagColored, util.Yellow("issues"))
-			}
-			log.Println()
+			message = fmt.Sprintf("%d series checked, all quiet.", len(animes))
 		}
+
+		s.logger.Info(message, scheduleTag,
+			"run_id", stats.ID,
+			"started", dateTimePart,
+			"duration", stats.Duration().Round(time.Millisecond).String())
+		return
 	}
+	logging.Heading(s.logger, "----- Scheduled Run Starting -----", scheduleTag,
+		"started", runStartTime.Format("2006-01-02 15:04:05"))
+	s.logger.Info("----- Scheduled Run Finished -----", scheduleTag,
+		"run_id", stats.ID,
+		"finished", stats.FinishedAt.Format("2006-01-02 15:04:05"),
+		"duration", stats.Duration().Round(time.Millisecond).String())
+	if stats.Errors > 0 {
+		s.logger.Warn("Scheduled run completed with issues.", scheduleTag, "errors", stats.Errors)
+	}
+}
+
+// Run processes every anime once, or, with a cron spec, once at startup and
+// then on schedule until the scheduler's context is done. It returns the
+// number of entries that failed in single run mode, and 0 otherwise. An
+// error means the cron jobs could not be scheduled after the initial run.
+func (s *Scheduler) Run() (int, error) {
+	appConfig, _, _ := s.current()
+	cronSpec := appConfig.Schedule.CronSpec
 
 	if cronSpec == "" {
-		log.Println()
-		log.Println(util.BlueBold("--- Single Run Mode ---"))
-		errors, _ := runChecks(appConfig, sClient, dryRun, false)
-		return errors
+		logging.Heading(s.logger, "--- Single Run Mode ---")
+		s.running.Lock()
+		defer s.running.Unlock()
+		return s.runChecks(NewRunID(), TriggerOnce, appConfig.Animes, false).Errors, nil
 	}
 
-	log.Println(util.BlueBold("\n--- Scheduler Mode ---"))
-	log.Printf("%s Cron Spec: %s.", schedulerTagColored, util.Yellow(cronSpec))
-	log.Printf("%s Performing initial check (verbose)...", schedulerTagColored)
-	_, _ = runChecks(appConfig, sClient, dryRun, false)
+	logging.Heading(s.logger, "--- Scheduler Mode ---")
+	s.logger.Info("Cron spec", scheduleTag, "cron", cronSpec)
+	s.logger.Info("Performing initial check (verbose)...", scheduleTag)
+	s.running.Lock()
+	s.runChecks(NewRunID(), TriggerStartup, appConfig.Animes, false)
+	s.running.Unlock()
+	if s.stopCtx.Err() != nil {
+		s.logger.Info("Scheduler stopped.", scheduleTag)
+		return 0, nil
+	}
 
-	log.Printf("%s Scheduler active. Waiting for next run...", schedulerTagColored)
-	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
-	_, err := c.AddFunc(cronSpec, jobFuncWrapper)
-	if err != nil {
-		log.Fatalf("%s Failed to add cron job: %v", util.RedBold("!!! FATAL"), err)
+	s.logger.Info("Scheduler active. Waiting for next run...", scheduleTag)
+	cronLogger := cron.PrintfLogger(slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn))
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cronLogger)))
+	// A reload during the initial run may have changed the schedules.
+	s.cfgMu.Lock()
+	s.cron = c
+	if err := s.scheduleJobs(s.appConfig); err != nil {
+		s.cfgMu.Unlock()
+		return 0, fmt.Errorf("failed to add cron job: %w", err)
 	}
 	c.Start()
-	select {}
+	s.logNextRuns(s.appConfig)
+	s.cfgMu.Unlock()
+
+	<-s.stopCtx.Done()
+	s.logger.Info("Shutdown requested, stopping scheduler...", scheduleTag)
+	<-c.Stop().Done()
+	// Wait for a manual run as well; workCtx bounds how long it can take.
+	s.running.Lock()
+	s.running.Unlock()
+	s.logger.Info("Scheduler stopped.", scheduleTag)
+	return 0, nil
+}
+
+// Reload switches to newConfig once no run is in progress: the anime list,
+// dry-run flag, Sonarr client and cron spec are replaced, and the differences
+// to the previous config are logged. newConfig must already be validated.
+// Log, server and shutdown settings keep their startup values.
+func (s *Scheduler) Reload(newConfig config.Config) error {
+	if s.stopCtx.Err() != nil {
+		return ErrShuttingDown
+	}
+	if newConfig.Schedule.CronSpec == "" {
+		return errors.New("schedule.cron_spec cannot be removed while the scheduler is running")
+	}
+
+	s.running.Lock()
+	defer s.running.Unlock()
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	oldConfig := s.appConfig
+
+	diff := config.DiffAnimes(oldConfig.Animes, newConfig.Animes)
+	sonarrChanged := oldConfig.Sonarr != newConfig.Sonarr
+	fillerListChanged := oldConfig.FillerList != newConfig.FillerList
+	cronChanged := oldConfig.Schedule.CronSpec != newConfig.Schedule.CronSpec
+	schedulesChanged := !slices.Equal(animeSpecs(oldConfig), animeSpecs(newConfig))
+	dryRunChanged := s.dryRun != newConfig.DryRun
+	if diff.Empty() && !sonarrChanged && !fillerListChanged && !cronChanged && !dryRunChanged && !schedulesChanged {
+		s.logger.Info("Config file changed, nothing to reload", scheduleTag)
+		return nil
+	}
+
+	reschedule := (cronChanged || schedulesChanged) && s.cron != nil
+	if reschedule {
+		if err := s.scheduleJobs(newConfig); err != nil {
+			return err
+		}
+	}
+	if sonarrChanged {
+		s.sClient = sonarr.NewClient(newConfig, s.logger)
+	}
+	if fillerListChanged {
+		canon.Configure(newConfig, s.logger)
+	}
+	s.appConfig = newConfig
+	s.dryRun = newConfig.DryRun
+
+	s.logger.Info("Config reloaded", scheduleTag,
+		"added", len(diff.Added),
+		"removed", len(diff.Removed),
+		"changed", len(diff.Changed))
+	for _, name := range diff.Added {
+		s.logger.Info("Anime entry added", scheduleTag, "anime", name)
+	}
+	for _, name := range diff.Removed {
+		s.logger.Info("Anime entry removed", scheduleTag, "anime", name)
+	}
+	for _, name := range diff.Changed {
+		s.logger.Info("Anime entry changed", scheduleTag, "anime", name)
+	}
+	if sonarrChanged {
+		s.logger.Info("Sonarr settings changed", scheduleTag, "baseurl", newConfig.Sonarr.BaseURL)
+	}
+	if fillerListChanged {
+		s.logger.Info("AnimeFillerList settings changed", scheduleTag)
+	}
+	if cronChanged {
+		s.logger.Info("Cron spec changed", scheduleTag, "from", oldConfig.Schedule.CronSpec, "to", newConfig.Schedule.CronSpec)
+	}
+	if dryRunChanged {
+		s.logger.Warn("Dry run setting changed", scheduleTag, "dry_run", newConfig.DryRun)
+	}
+	if oldConfig.Log != newConfig.Log || oldConfig.Server != newConfig.Server || oldConfig.State != newConfig.State ||
+		oldConfig.Schedule.ShutdownTimeoutSeconds != newConfig.Schedule.ShutdownTimeoutSeconds {
+		s.logger.Warn("Changes to log, server, state and shutdown settings take effect after a restart", scheduleTag)
+	}
+	if reschedule {
+		s.logNextRuns(newConfig)
+	}
+	return nil
+}
+
+// animeSpecs lists each entry's name with its effective cron spec, so that
+// reloads can tell whether any schedule moved.
+func animeSpecs(appConfig config.Config) []string {
+	specs := make([]string, 0, len(appConfig.Animes))
+	for _, animeCfg := range appConfig.Animes {
+		specs = append(specs, animeCfg.DisplayName()+"\x00"+animeCfg.CronSpec(appConfig.Schedule.CronSpec))
+	}
+	return specs
 }
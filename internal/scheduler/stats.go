@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"time"
+
+	"kotei/internal/processor"
+)
+
+const (
+	TriggerOnce     = "once"
+	TriggerStartup  = "startup"
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+	// TriggerApply marks the execution of a saved plan by 'kotei apply'.
+	TriggerApply = "apply"
+	// TriggerRollback marks the undoing of an earlier run by 'kotei rollback'.
+	TriggerRollback = "rollback"
+)
+
+const (
+	AnimeStatusOK       = "ok"
+	AnimeStatusError    = "error"
+	AnimeStatusNotFound = "not_found"
+)
+
+// AnimeResult is the outcome of one anime entry within a run. The episode
+// lists hold what was changed in Sonarr, or would have been in a dry run.
+type AnimeResult struct {
+	Anime       string                     `json:"anime"`
+	Status      string                     `json:"status"`
+	ActionTaken bool                       `json:"action_taken"`
+	Error       string                     `json:"error,omitempty"`
+	FinishedAt  time.Time                  `json:"finished_at"`
+	SeriesID    int                        `json:"sonarr_series_id,omitempty"`
+	SeriesTitle string                     `json:"sonarr_series_title,omitempty"`
+	SeriesSlug  string                     `json:"sonarr_series_slug,omitempty"`
+	Monitored   []processor.PlannedEpisode `json:"monitored,omitempty"`
+	Unmonitored []processor.PlannedEpisode `json:"unmonitored,omitempty"`
+	Searched    []processor.PlannedEpisode `json:"searched,omitempty"`
+}
+
+// RunStats summarizes a finished run; it carries the numbers of the
+// "[Run Stats]" log line.
+type RunStats struct {
+	ID         string    `json:"id"`
+	Trigger    string    `json:"trigger"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DryRun     bool      `json:"dry_run"`
+	Processed  int       `json:"processed"`
+	OK         int       `json:"ok"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Errors     int       `json:"errors"`
+	AllQuiet   bool      `json:"all_quiet"`
+	// Interrupted is set when shutdown stopped the run before every entry
+	// was processed.
+	Interrupted bool          `json:"interrupted,omitempty"`
+	Animes      []AnimeResult `json:"animes"`
+}
+
+// Duration returns how long the run took.
+func (r RunStats) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Result classifies the run as "success", "partial" (only skips) or "failed".
+func (r RunStats) Result() string {
+	switch {
+	case r.Failed > 0:
+		return "failed"
+	case r.Errors > 0:
+		return "partial"
+	}
+	return "success"
+}
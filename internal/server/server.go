@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"kotei/internal/config"
+	"kotei/internal/logging"
+	"kotei/internal/metrics"
+	"kotei/internal/scheduler"
+)
+
+const readinessTimeout = 5 * time.Second
+
+// Server is the optional HTTP API for observing and triggering runs while
+// the scheduler is active. It also serves Prometheus metrics on /metrics.
+type Server struct {
+	sched  *scheduler.Scheduler
+	logger *slog.Logger
+	http   *http.Server
+	// token guards POST /api/run when set.
+	token string
+}
+
+func New(listen string, token string, sched *scheduler.Scheduler, logger *slog.Logger) *Server {
+	s := &Server{
+		sched:  sched,
+		logger: logging.OrDiscard(logger).With(logging.ComponentKey, "http"),
+		token:  token,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("GET /api/runs/last", s.handleLastRun)
+	mux.HandleFunc("POST /api/run", s.handleRun)
+	mux.Handle("GET /metrics", metrics.Handler())
+	s.http = &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Start listens in the background. It fails only if the address cannot be
+// bound.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("HTTP server listening", "listen", listener.Addr().String())
+	if s.token == "" && !isLoopback(s.http.Addr) {
+		s.logger.Warn("POST /api/run accepts runs from anyone who can reach the server; set server.token to require a token")
+	}
+	go func() {
+		if err := s.http.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("HTTP server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for open ones until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+// isLoopback reports whether listen only accepts local connections.
+func isLoopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// authorized checks the bearer token of r against server.token.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+type readiness struct {
+	Ready       bool    `json:"ready"`
+	Sonarr      string  `json:"sonarr"`
+	SonarrError string  `json:"sonarr_error,omitempty"`
+	LastRun     *string `json:"last_run"`
+}
+
+// handleReady reports ready when Sonarr answers and the last run, if any,
+// did not fail.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	status := readiness{Ready: true, Sonarr: "ok"}
+	if err := s.sched.SonarrClient().Ping(ctx); err != nil {
+		status.Ready = false
+		status.Sonarr = "unreachable"
+		status.SonarrError = err.Error()
+	}
+	if last, ok := s.sched.LastRun(); ok {
+		result := last.Result()
+		status.LastRun = &result
+		if result == "failed" {
+			status.Ready = false
+		}
+	}
+
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+func (s *Server) handleLastRun(w http.ResponseWriter, _ *http.Request) {
+	last, ok := s.sched.LastRun()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no run has finished yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, last)
+}
+
+// handleRun starts a run in the background, optionally for the single entry
+// named by ?anime=. It answers 401 without the configured token and 409
+// while another run is in progress.
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kotei"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid token"})
+		s.logger.Warn("Unauthorized run request", "remote", r.RemoteAddr)
+		return
+	}
+	anime := r.URL.Query().Get("anime")
+	runID, err := s.sched.Trigger(anime)
+	switch {
+	case errors.Is(err, scheduler.ErrRunInProgress):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, scheduler.ErrShuttingDown):
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, config.ErrNoAnimeMatch):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	s.logger.Info("Manual run triggered", "run_id", runID, "anime", anime, "remote", r.RemoteAddr)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "started", "run_id": runID})
+}
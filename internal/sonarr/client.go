@@ -1,37 +1,246 @@
 package sonarr
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"kotei/internal/config"
+	"kotei/internal/logging"
+	"kotei/internal/metrics"
 	"kotei/internal/util"
 
 	"github.com/go-resty/resty/v2"
 )
 
-var NilLogger = log.New(io.Discard, "", 0)
+var NilLogger = logging.Discard()
 
 var ErrSeriesNotFound = errors.New("series not found in Sonarr")
 
-type Series struct {
-	ID    int    `json:"id"`
+type AlternateTitle struct {
 	Title string `json:"title"`
 }
+type Series struct {
+	ID              int              `json:"id"`
+	TvdbID          int              `json:"tvdbId"`
+	Title           string           `json:"title"`
+	CleanTitle      string           `json:"cleanTitle"`
+	TitleSlug       string           `json:"titleSlug"`
+	AlternateTitles []AlternateTitle `json:"alternateTitles"`
+	SeriesType      string           `json:"seriesType"`
+}
+
+// SeriesQuery identifies a series in Sonarr. SonarrID and TvdbID take
+// precedence over Title when set.
+type SeriesQuery struct {
+	Title    string
+	TvdbID   int
+	SonarrID int
+}
+
+func (q SeriesQuery) String() string {
+	switch {
+	case q.SonarrID != 0:
+		return fmt.Sprintf("sonarr_id %d", q.SonarrID)
+	case q.TvdbID != 0:
+		return fmt.Sprintf("tvdb_id %d", q.TvdbID)
+	}
+	return fmt.Sprintf("'%s'", q.Title)
+}
+
+// SeriesURL returns the page of a series in the Sonarr web UI, or "" when
+// the slug is unknown.
+func SeriesURL(baseURL, titleSlug string) string {
+	if titleSlug == "" {
+		return ""
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/series/" + titleSlug
+}
+
+// cleanSeriesTitle approximates Sonarr's cleanTitle: lower case letters and
+// digits only.
+func cleanSeriesTitle(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// SeriesIndex is a snapshot of the Sonarr library with lookups by ID, TVDB ID,
+// title, alternate title and clean title. Build it once per run with
+// FetchSeriesIndex and share it between all anime entries.
+type SeriesIndex struct {
+	series  []Series
+	byID    map[int]Series
+	byTvdb  map[int]Series
+	byTitle map[string]Series
+	byAlt   map[string]altMatch
+	byClean map[string]Series
+}
+
+type altMatch struct {
+	series Series
+	title  string
+}
+
+func NewSeriesIndex(seriesList []Series) *SeriesIndex {
+	idx := &SeriesIndex{
+		series:  seriesList,
+		byID:    make(map[int]Series, len(seriesList)),
+		byTvdb:  make(map[int]Series, len(seriesList)),
+		byTitle: make(map[string]Series, len(seriesList)),
+		byAlt:   make(map[string]altMatch),
+		byClean: make(map[string]Series, len(seriesList)),
+	}
+	for _, series := range seriesList {
+		idx.byID[series.ID] = series
+		if series.TvdbID != 0 {
+			if _, exists := idx.byTvdb[series.TvdbID]; !exists {
+				idx.byTvdb[series.TvdbID] = series
+			}
+		}
+		titleKey := strings.ToLower(series.Title)
+		if _, exists := idx.byTitle[titleKey]; !exists {
+			idx.byTitle[titleKey] = series
+		}
+		for _, alt := range series.AlternateTitles {
+			altKey := strings.ToLower(alt.Title)
+			if _, exists := idx.byAlt[altKey]; !exists {
+				idx.byAlt[altKey] = altMatch{series: series, title: alt.Title}
+			}
+		}
+		for _, clean := range []string{series.CleanTitle, cleanSeriesTitle(series.Title)} {
+			if clean == "" {
+				continue
+			}
+			if _, exists := idx.byClean[clean]; !exists {
+				idx.byClean[clean] = series
+			}
+		}
+	}
+	return idx
+}
+
+// Len returns the number of series in the index.
+func (idx *SeriesIndex) Len() int {
+	return len(idx.series)
+}
+
+// Find looks up the series for a query, returning a description of the rule
+// that matched. Title rules are tried in order: exact title, alternate title,
+// then clean title.
+func (idx *SeriesIndex) Find(q SeriesQuery) (Series, string, bool) {
+	if q.SonarrID != 0 {
+		series, ok := idx.byID[q.SonarrID]
+		return series, "sonarr_id", ok
+	}
+	if q.TvdbID != 0 {
+		series, ok := idx.byTvdb[q.TvdbID]
+		return series, "tvdb_id", ok
+	}
+	if strings.TrimSpace(q.Title) == "" {
+		return Series{}, "", false
+	}
+	if series, ok := idx.byTitle[strings.ToLower(q.Title)]; ok {
+		return series, "title", true
+	}
+	if match, ok := idx.byAlt[strings.ToLower(q.Title)]; ok {
+		return match.series, fmt.Sprintf("alternate title '%s'", match.title), true
+	}
+	if queryClean := cleanSeriesTitle(q.Title); queryClean != "" {
+		if series, ok := idx.byClean[queryClean]; ok {
+			return series, "clean title", true
+		}
+	}
+	return Series{}, "", false
+}
+
 type Episode struct {
-	ID                    int    `json:"id"`
-	AbsoluteEpisodeNumber int    `json:"absoluteEpisodeNumber"`
-	Monitored             bool   `json:"monitored"`
-	Title                 string `json:"title"`
-	SeasonNumber          int    `json:"seasonNumber"`
-	EpisodeNumber         int    `json:"episodeNumber"`
+	ID                         int    `json:"id"`
+	AbsoluteEpisodeNumber      int    `json:"absoluteEpisodeNumber"`
+	SceneAbsoluteEpisodeNumber int    `json:"sceneAbsoluteEpisodeNumber"`
+	Monitored                  bool   `json:"monitored"`
+	Title                      string `json:"title"`
+	SeasonNumber               int    `json:"seasonNumber"`
+	EpisodeNumber              int    `json:"episodeNumber"`
+
+	// MatchNumber is the number the episode was matched on under the selected
+	// MatchStrategy. It is not part of the Sonarr API.
+	MatchNumber int `json:"-"`
+}
+
+type MatchStrategy string
+
+const (
+	MatchAbsolute      MatchStrategy = "absolute"
+	MatchSceneAbsolute MatchStrategy = "scene_absolute"
+	MatchSeasonOrder   MatchStrategy = "season_order"
+)
+
+// ParseMatchStrategy validates a match_by value; an empty value selects
+// MatchAbsolute.
+func ParseMatchStrategy(value string) (MatchStrategy, error) {
+	strategy := MatchStrategy(strings.ToLower(strings.TrimSpace(value)))
+	switch strategy {
+	case "":
+		return MatchAbsolute, nil
+	case MatchAbsolute, MatchSceneAbsolute, MatchSeasonOrder:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown match_by '%s' (expected absolute, scene_absolute or season_order)", value)
 }
+
+// IndexEpisodes keys a series' episodes by the number the strategy matches on.
+// Episodes without such a number are left out. For MatchSeasonOrder, regular
+// episodes are numbered 1..n in season/episode order, skipping specials.
+func IndexEpisodes(episodes []Episode, strategy MatchStrategy) map[int]Episode {
+	index := make(map[int]Episode)
+	switch strategy {
+	case MatchSeasonOrder:
+		ordered := make([]Episode, 0, len(episodes))
+		for _, ep := range episodes {
+			if ep.SeasonNumber > 0 && ep.EpisodeNumber > 0 {
+				ordered = append(ordered, ep)
+			}
+		}
+		sort.Slice(ordered, func(i, j int) bool {
+			if ordered[i].SeasonNumber != ordered[j].SeasonNumber {
+				return ordered[i].SeasonNumber < ordered[j].SeasonNumber
+			}
+			return ordered[i].EpisodeNumber < ordered[j].EpisodeNumber
+		})
+		for i, ep := range ordered {
+			ep.MatchNumber = i + 1
+			index[ep.MatchNumber] = ep
+		}
+	case MatchSceneAbsolute:
+		for _, ep := range episodes {
+			if ep.SceneAbsoluteEpisodeNumber > 0 {
+				ep.MatchNumber = ep.SceneAbsoluteEpisodeNumber
+				index[ep.MatchNumber] = ep
+			}
+		}
+	default:
+		for _, ep := range episodes {
+			if ep.AbsoluteEpisodeNumber > 0 {
+				ep.MatchNumber = ep.AbsoluteEpisodeNumber
+				index[ep.MatchNumber] = ep
+			}
+		}
+	}
+	return index
+}
+
 type EpisodeMonitorRequest struct {
 	EpisodeIDs []int `json:"episodeIds"`
 	Monitored  bool  `json:"monitored"`
@@ -43,13 +252,18 @@ type SonarrCommandRequest struct {
 
 type Client struct {
 	resty  *resty.Client
-	logger *log.Logger
+	logger *slog.Logger
+	tagged *slog.Logger
 }
 
-func NewClient(cfg config.Config, appLogger *log.Logger) *Client {
+// NewClient builds a Sonarr API client. Progress is logged to appLogger, or
+// the default logger when nil; request errors are always logged there, even
+// while SetLogger has silenced progress output.
+func NewClient(cfg config.Config, appLogger *slog.Logger) *Client {
 	if appLogger == nil {
-		appLogger = log.Default()
+		appLogger = slog.Default()
 	}
+	errLogger := appLogger.With(logging.ComponentKey, "sonarr")
 	cleanBaseURL := strings.TrimSuffix(cfg.Sonarr.BaseURL, "/")
 	sonarrFullBaseURL := cleanBaseURL + cfg.Sonarr.APIPath
 	restyClient := resty.New().
@@ -58,74 +272,131 @@ func NewClient(cfg config.Config, appLogger *log.Logger) *Client {
 		SetTimeout(time.Duration(cfg.Sonarr.TimeoutSeconds) * time.Second).
 		SetRetryCount(cfg.Sonarr.RetryCount).
 		SetRetryWaitTime(time.Duration(cfg.Sonarr.RetryWaitSeconds) * time.Second).
+		OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+			if resp.IsError() {
+				metrics.SonarrAPIError(resp.Request.Method, apiEndpoint(resp.Request.URL), strconv.Itoa(resp.StatusCode()))
+			}
+			return nil
+		}).
 		OnError(func(req *resty.Request, err error) {
-			errMsg := fmt.Sprintf("API Request Error. URL: %s, Method: %s", req.URL, req.Method)
-			if err != nil {
-				log.Printf("  %s %s | Error: %v", util.RedBold("[SONARR HTTP ERR]"), errMsg, err.Error())
-				if v, ok := err.(*resty.ResponseError); ok && v.Response != nil {
-					if len(v.Response.Body()) > 0 && len(v.Response.Body()) < 500 {
-						log.Printf("  %s Response Body: %s", util.RedBold("[SONARR HTTP ERR]"), string(v.Response.Body()))
-					}
+			// Responses with an error status were counted in OnAfterResponse.
+			var responseErr *resty.ResponseError
+			if !errors.As(err, &responseErr) || responseErr.Response == nil || responseErr.Response.RawResponse == nil {
+				metrics.SonarrAPIError(req.Method, apiEndpoint(req.URL), "error")
+			}
+			attrs := []any{"method", req.Method, "url", req.URL}
+			if err == nil {
+				errLogger.Error("API request failed with unknown error", attrs...)
+				return
+			}
+			attrs = append(attrs, "error", err)
+			if v, ok := err.(*resty.ResponseError); ok && v.Response != nil && v.Response.RawResponse != nil {
+				attrs = append(attrs, "status", v.Response.StatusCode())
+				if len(v.Response.Body()) > 0 && len(v.Response.Body()) < 500 {
+					attrs = append(attrs, "body", string(v.Response.Body()))
 				}
-			} else {
-				log.Printf("  %s %s | Unknown Error (err is nil)", util.RedBold("[SONARR HTTP ERR]"), errMsg)
 			}
+			errLogger.Error("API request failed", attrs...)
 		})
-	return &Client{resty: restyClient, logger: appLogger}
+	c := &Client{resty: restyClient}
+	c.SetLogger(appLogger)
+	return c
+}
+
+// apiEndpoint reduces a request URL to its API path, such as "/episode", to
+// keep metric label values bounded.
+func apiEndpoint(requestURL string) string {
+	if i := strings.IndexAny(requestURL, "?#"); i >= 0 {
+		requestURL = requestURL[:i]
+	}
+	if i := strings.Index(requestURL, "/api/"); i >= 0 {
+		if j := strings.Index(requestURL[i+len("/api/"):], "/"); j >= 0 {
+			return requestURL[i+len("/api/")+j:]
+		}
+	}
+	return requestURL
 }
 
-func (c *Client) GetLogger() *log.Logger {
+// GetLogger returns the logger last passed to SetLogger.
+func (c *Client) GetLogger() *slog.Logger {
 	if c.logger == nil {
 		return NilLogger
 	}
 	return c.logger
 }
 
-func (c *Client) SetLogger(logger *log.Logger) {
+// SetLogger replaces the progress logger. The client tags its records with
+// the "sonarr" component.
+func (c *Client) SetLogger(logger *slog.Logger) {
 	if logger == nil {
-		c.logger = NilLogger
-	} else {
-		c.logger = logger
+		logger = NilLogger
 	}
+	c.logger = logger
+	c.tagged = logger.With(logging.ComponentKey, "sonarr")
 }
 
-func (c *Client) GetSeriesID(sonarrSeriesSearchTitle string) (int, error) {
+// Ping checks that Sonarr is reachable and accepts the API key. It makes a
+// single attempt, without the client's retries or error logging, so it is
+// cheap enough to back a readiness probe.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.resty.BaseURL+"/system/status", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create status request: %w", err)
+	}
+	req.Header.Set("X-Api-Key", c.resty.Header.Get("X-Api-Key"))
+	resp, err := c.resty.GetClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Sonarr: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Sonarr status check failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// FetchSeriesIndex downloads the full Sonarr library once and indexes it.
+func (c *Client) FetchSeriesIndex(ctx context.Context) (*SeriesIndex, error) {
 	var seriesList []Series
-	resp, err := c.resty.R().SetQueryParam("term", sonarrSeriesSearchTitle).SetResult(&seriesList).Get("/series")
+	resp, err := c.resty.R().SetContext(ctx).SetResult(&seriesList).Get("/series")
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to request series lookup for '%s': %w", sonarrSeriesSearchTitle, err)
+		return nil, fmt.Errorf("failed to request series list: %w", err)
 	}
 	if !resp.IsSuccess() {
-		return 0, fmt.Errorf("Sonarr API error searching series '%s'. Status: %s, Body: %s", sonarrSeriesSearchTitle, resp.Status(), resp.String())
+		return nil, fmt.Errorf("Sonarr API error fetching series list. Status: %s, Body: %s", resp.Status(), resp.String())
 	}
+	return NewSeriesIndex(seriesList), nil
+}
 
-	currentLogger := c.GetLogger()
-
-	for _, series := range seriesList {
-		if strings.EqualFold(series.Title, sonarrSeriesSearchTitle) {
-			currentLogger.Printf("  %s Series %s (ID: %s)",
-				util.Cyan("[SONARR]"),
-				util.Blue(fmt.Sprintf("'%s'", series.Title)),
-				util.Yellow(strconv.Itoa(series.ID)))
-			return series.ID, nil
-		}
+// GetSeries fetches the library and looks up a single series. Prefer
+// LookupSeries with a shared SeriesIndex when resolving several series.
+func (c *Client) GetSeries(ctx context.Context, query SeriesQuery) (Series, error) {
+	seriesIndex, err := c.FetchSeriesIndex(ctx)
+	if err != nil {
+		return Series{}, fmt.Errorf("failed series lookup for %s: %w", query, err)
 	}
-	currentLogger.Printf("  %s Series '%s' %s in %s (%d results, none matched exactly).",
-		util.Cyan("[SONARR]"),
-		sonarrSeriesSearchTitle,
-		util.RedBold("not found"),
-		util.Cyan("Sonarr"),
-		len(seriesList))
-	return 0, fmt.Errorf("%w: exact title '%s'", ErrSeriesNotFound, sonarrSeriesSearchTitle)
+	return c.LookupSeries(seriesIndex, query)
 }
 
-func (c *Client) GetEpisodeIDsToNewlyMonitor(sonarrSeriesID int, targetAbsoluteNumbers []int) ([]int, error) {
-	if len(targetAbsoluteNumbers) == 0 {
-		return []int{}, nil
+// LookupSeries resolves a query against an existing index, logging which rule
+// matched.
+func (c *Client) LookupSeries(seriesIndex *SeriesIndex, query SeriesQuery) (Series, error) {
+	currentLogger := c.tagged
+
+	if series, rule, ok := seriesIndex.Find(query); ok {
+		currentLogger.Info("Series matched",
+			"series", series.Title, "sonarr_series_id", series.ID, "matched_by", rule)
+		return series, nil
 	}
+	currentLogger.Warn("Series not found in Sonarr",
+		"query", query.String(), "library_size", seriesIndex.Len())
+	return Series{}, fmt.Errorf("%w: %s", ErrSeriesNotFound, query)
+}
+
+func (c *Client) GetSeriesEpisodes(ctx context.Context, sonarrSeriesID int) ([]Episode, error) {
 	var allSonarrEpisodes []Episode
-	resp, err := c.resty.R().SetQueryParam("seriesId", strconv.Itoa(sonarrSeriesID)).SetResult(&allSonarrEpisodes).Get("/episode")
+	resp, err := c.resty.R().SetContext(ctx).SetQueryParam("seriesId", strconv.Itoa(sonarrSeriesID)).SetResult(&allSonarrEpisodes).Get("/episode")
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to request episodes for series ID %d: %w", sonarrSeriesID, err)
@@ -133,81 +404,57 @@ func (c *Client) GetEpisodeIDsToNewlyMonitor(sonarrSeriesID int, targetAbsoluteN
 	if !resp.IsSuccess() {
 		return nil, fmt.Errorf("Sonarr API error fetching episodes for series ID %d. Status: %s, Body: %s", sonarrSeriesID, resp.Status(), resp.String())
 	}
+	return allSonarrEpisodes, nil
+}
 
-	currentLogger := c.GetLogger()
-	episodesToNewlyMonitor := []int{}
-	sonarrEpsMap := make(map[int]Episode)
-	for _, ep := range allSonarrEpisodes {
-		if ep.AbsoluteEpisodeNumber > 0 {
-			sonarrEpsMap[ep.AbsoluteEpisodeNumber] = ep
-		}
-	}
-
-	newlyMon, alreadyMon, notFoundCount := 0, 0, 0
-	for _, absNum := range targetAbsoluteNumbers {
-		sonarrEp, ok := sonarrEpsMap[absNum]
-		if ok {
-			if !sonarrEp.Monitored {
-				episodesToNewlyMonitor = append(episodesToNewlyMonitor, sonarrEp.ID)
-				newlyMon++
-			} else {
-				alreadyMon++
-			}
-		} else {
-			notFoundCount++
-		}
-	}
-	notFoundMsg := ""
-	if notFoundCount > 0 {
-		notFoundMsg = fmt.Sprintf(", %d not found in Sonarr", notFoundCount)
-	}
+func (c *Client) MonitorEpisodes(ctx context.Context, sonarrInternalEpisodeIDs []int, dryRun bool) error {
+	return c.setEpisodesMonitored(ctx, sonarrInternalEpisodeIDs, true, dryRun)
+}
 
-	if newlyMon > 0 || alreadyMon > 0 || notFoundCount > 0 {
-		currentLogger.Printf("  %s Episodes: %s to newly monitor, %s already monitored%s.",
-			util.Cyan("[SONARR]"), util.GreenBold(strconv.Itoa(newlyMon)), util.Green(strconv.Itoa(alreadyMon)), notFoundMsg)
-	}
-	return episodesToNewlyMonitor, nil
+func (c *Client) UnmonitorEpisodes(ctx context.Context, sonarrInternalEpisodeIDs []int, dryRun bool) error {
+	return c.setEpisodesMonitored(ctx, sonarrInternalEpisodeIDs, false, dryRun)
 }
 
-func (c *Client) MonitorEpisodes(sonarrInternalEpisodeIDs []int, dryRun bool) error {
+func (c *Client) setEpisodesMonitored(ctx context.Context, sonarrInternalEpisodeIDs []int, monitored bool, dryRun bool) error {
 	if len(sonarrInternalEpisodeIDs) == 0 {
 		return nil
 	}
-	currentLogger := c.GetLogger()
-	actionMsg := fmt.Sprintf("  %s Monitoring %s episodes...", util.Cyan("[SONARR]"), util.GreenBold(strconv.Itoa(len(sonarrInternalEpisodeIDs))))
+	currentLogger := c.tagged
+	actionMsg := util.Iif(monitored, "Monitoring episodes", "Unmonitoring episodes")
 	if dryRun {
-		currentLogger.Printf("%s %s", actionMsg, util.YellowBold("(DRY RUN)"))
+		currentLogger.Info(actionMsg, "count", len(sonarrInternalEpisodeIDs), "dry_run", true)
 		return nil
 	}
 
-	currentLogger.Printf("%s", actionMsg)
+	currentLogger.Info(actionMsg, "count", len(sonarrInternalEpisodeIDs))
 	resp, err := c.resty.R().
-		SetBody(EpisodeMonitorRequest{EpisodeIDs: sonarrInternalEpisodeIDs, Monitored: true}).
+		SetContext(ctx).
+		SetBody(EpisodeMonitorRequest{EpisodeIDs: sonarrInternalEpisodeIDs, Monitored: monitored}).
 		Put("/episode/monitor")
 
 	if err != nil {
-		return fmt.Errorf("failed to send monitor request for %d episodes: %w", len(sonarrInternalEpisodeIDs), err)
+		return fmt.Errorf("failed to send %s request for %d episodes: %w", util.Iif(monitored, "monitor", "unmonitor"), len(sonarrInternalEpisodeIDs), err)
 	}
 	if resp.StatusCode() != http.StatusAccepted && resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("Sonarr API error setting episodes to monitored. Expected 200/202, Got %s. Body: %s", resp.Status(), resp.String())
+		return fmt.Errorf("Sonarr API error setting episodes to %s. Expected 200/202, Got %s. Body: %s", util.Iif(monitored, "monitored", "unmonitored"), resp.Status(), resp.String())
 	}
-	currentLogger.Printf("    └─ %s Status: %s", util.Cyan("[SONARR]"), util.Green("OK"))
+	currentLogger.Debug("Monitor update accepted", "monitored", monitored, "count", len(sonarrInternalEpisodeIDs))
 	return nil
 }
 
-func (c *Client) SearchEpisodes(sonarrInternalEpisodeIDs []int, dryRun bool) error {
+func (c *Client) SearchEpisodes(ctx context.Context, sonarrInternalEpisodeIDs []int, dryRun bool) error {
 	if len(sonarrInternalEpisodeIDs) == 0 {
 		return nil
 	}
-	currentLogger := c.GetLogger()
-	actionMsg := fmt.Sprintf("  %s Searching for %s episodes...", util.Cyan("[SONARR]"), util.GreenBold(strconv.Itoa(len(sonarrInternalEpisodeIDs))))
+	currentLogger := c.tagged
 	if dryRun {
-		currentLogger.Printf("%s %s", actionMsg, util.YellowBold("(DRY RUN)"))
+		currentLogger.Info("Searching for episodes", "count", len(sonarrInternalEpisodeIDs), "dry_run", true)
 		return nil
 	}
 
-	currentLogger.Printf("%s", actionMsg)
+	currentLogger.Info("Searching for episodes", "count", len(sonarrInternalEpisodeIDs))
 	resp, err := c.resty.R().
+		SetContext(ctx).
 		SetBody(SonarrCommandRequest{Name: "EpisodeSearch", EpisodeIDs: sonarrInternalEpisodeIDs}).
 		Post("/command")
 
@@ -217,6 +464,6 @@ func (c *Client) SearchEpisodes(sonarrInternalEpisodeIDs []int, dryRun bool) err
 	if resp.StatusCode() != http.StatusCreated {
 		return fmt.Errorf("Sonarr API error queuing search. Expected 201, Got %s. Body: %s", resp.Status(), resp.String())
 	}
-	currentLogger.Printf("    └─ %s Status: %s (%d eps)", util.Cyan("[SONARR]"), util.Green("Queued"), len(sonarrInternalEpisodeIDs))
+	currentLogger.Info("Search queued", "count", len(sonarrInternalEpisodeIDs))
 	return nil
 }
@@ -0,0 +1,428 @@
+// Package state keeps Kotei's history between runs in a single bbolt file:
+// every run, the outcome of each anime entry in it and every episode that
+// was monitored, unmonitored or searched. It also holds the runs queued for
+// a daily or weekly email digest.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"kotei/internal/processor"
+	"kotei/internal/scheduler"
+)
+
+// FileName is the name of the store within the data dir.
+const FileName = "kotei.db"
+
+// lockTimeout bounds the wait for another Kotei process holding the file,
+// e.g. 'kotei history' while the scheduler records a run.
+const lockTimeout = 5 * time.Second
+
+var (
+	runsBucket        = []byte("runs")
+	runIDsBucket      = []byte("run_ids")
+	emailDigestBucket = []byte("email_digest")
+	emailDigestKey    = []byte("digest")
+)
+
+// ErrRunNotFound is returned by Run for an unknown run ID.
+var ErrRunNotFound = errors.New("run not found")
+
+// EpisodeChange is one episode Kotei monitored, unmonitored or searched.
+type EpisodeChange struct {
+	Action    processor.Action `json:"action"`
+	Time      time.Time        `json:"time"`
+	EpisodeID int              `json:"episode_id"`
+	Number    int              `json:"number"`
+	Season    int              `json:"season"`
+	Episode   int              `json:"episode"`
+	Title     string           `json:"title"`
+	// PreviousMonitored is the monitored flag before a monitor or unmonitor
+	// change; it is not recorded for searches.
+	PreviousMonitored *bool `json:"previous_monitored,omitempty"`
+}
+
+// Monitored reports the monitored flag the change set, and whether it set
+// one at all.
+func (c EpisodeChange) Monitored() (bool, bool) {
+	switch c.Action {
+	case processor.ActionMonitor:
+		return true, true
+	case processor.ActionUnmonitor:
+		return false, true
+	}
+	return false, false
+}
+
+// Previous returns the monitored flag before the change. Runs recorded
+// without it fall back to the opposite of the flag set, as plans only pick
+// episodes whose flag differs.
+func (c EpisodeChange) Previous() bool {
+	if c.PreviousMonitored != nil {
+		return *c.PreviousMonitored
+	}
+	monitored, _ := c.Monitored()
+	return !monitored
+}
+
+// AnimeOutcome is what happened to one anime entry within a run.
+type AnimeOutcome struct {
+	Anime       string          `json:"anime"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	FinishedAt  time.Time       `json:"finished_at"`
+	SeriesID    int             `json:"sonarr_series_id,omitempty"`
+	SeriesTitle string          `json:"sonarr_series_title,omitempty"`
+	Changes     []EpisodeChange `json:"changes,omitempty"`
+}
+
+// Count returns the number of changes with the given action.
+func (a AnimeOutcome) Count(action processor.Action) int {
+	n := 0
+	for _, change := range a.Changes {
+		if change.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Run is a recorded run.
+type Run struct {
+	ID          string    `json:"id"`
+	Trigger     string    `json:"trigger"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	DryRun      bool      `json:"dry_run"`
+	Result      string    `json:"result"`
+	Processed   int       `json:"processed"`
+	OK          int       `json:"ok"`
+	Skipped     int       `json:"skipped"`
+	Failed      int       `json:"failed"`
+	Interrupted bool      `json:"interrupted,omitempty"`
+	// RollbackOf is the run a rollback undid, and RolledBackBy the rollback
+	// that undid this run.
+	RollbackOf   string         `json:"rollback_of,omitempty"`
+	RolledBackBy string         `json:"rolled_back_by,omitempty"`
+	Animes       []AnimeOutcome `json:"animes"`
+}
+
+// Count returns the number of changes with the given action over all
+// entries of the run.
+func (r Run) Count(action processor.Action) int {
+	n := 0
+	for _, anime := range r.Animes {
+		n += anime.Count(action)
+	}
+	return n
+}
+
+// FromStats converts the stats of a finished run into its record.
+func FromStats(stats scheduler.RunStats) Run {
+	run := Run{
+		ID:          stats.ID,
+		Trigger:     stats.Trigger,
+		StartedAt:   stats.StartedAt,
+		FinishedAt:  stats.FinishedAt,
+		DryRun:      stats.DryRun,
+		Result:      stats.Result(),
+		Processed:   stats.Processed,
+		OK:          stats.OK,
+		Skipped:     stats.Skipped,
+		Failed:      stats.Failed,
+		Interrupted: stats.Interrupted,
+		Animes:      make([]AnimeOutcome, 0, len(stats.Animes)),
+	}
+	for _, result := range stats.Animes {
+		outcome := AnimeOutcome{
+			Anime:       result.Anime,
+			Status:      result.Status,
+			Error:       result.Error,
+			FinishedAt:  result.FinishedAt,
+			SeriesID:    result.SeriesID,
+			SeriesTitle: result.SeriesTitle,
+		}
+		for _, change := range []struct {
+			action   processor.Action
+			episodes []processor.PlannedEpisode
+		}{
+			{processor.ActionMonitor, result.Monitored},
+			{processor.ActionUnmonitor, result.Unmonitored},
+			{processor.ActionSearch, result.Searched},
+		} {
+			for _, ep := range change.episodes {
+				episodeChange := EpisodeChange{
+					Action:    change.action,
+					Time:      result.FinishedAt,
+					EpisodeID: ep.EpisodeID,
+					Number:    ep.Number,
+					Season:    ep.SeasonNumber,
+					Episode:   ep.EpisodeNumber,
+					Title:     ep.Title,
+				}
+				if change.action != processor.ActionSearch {
+					wasMonitored := ep.WasMonitored
+					episodeChange.PreviousMonitored = &wasMonitored
+				}
+				outcome.Changes = append(outcome.Changes, episodeChange)
+			}
+		}
+		run.Animes = append(run.Animes, outcome)
+	}
+	return run
+}
+
+// Store is the state file. The file is opened for each operation and closed
+// again, so other Kotei commands can read it while the scheduler is running.
+type Store struct {
+	path string
+}
+
+// Path returns the location of the store in dir, or in a "kotei" directory
+// under the user config directory when dir is empty.
+func Path(dir string) (string, error) {
+	if dir == "" {
+		userConfigDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(userConfigDir, "kotei")
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+// Open creates the store in dir if needed and checks that it can be written.
+func Open(dir string) (*Store, error) {
+	path, err := Path(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{path: path}
+	err = s.update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{runsBucket, runIDsBucket, emailDigestBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenExisting returns the store in dir for reading. It fails with an error
+// wrapping os.ErrNotExist when nothing has been recorded yet.
+func OpenExisting(dir string) (*Store, error) {
+	path, err := Path(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return &Store{path: path}, nil
+}
+
+// Path returns the location of the state file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+func (s *Store) update(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0o600, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		return fmt.Errorf("failed to open state file %s: %w", s.path, err)
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+func (s *Store) view(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0o600, &bolt.Options{Timeout: lockTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open state file %s: %w", s.path, err)
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(runsBucket) == nil || tx.Bucket(runIDsBucket) == nil {
+			return fmt.Errorf("state file %s is not initialized", s.path)
+		}
+		return fn(tx)
+	})
+}
+
+// runKey orders runs by start time; the ID keeps runs started within the
+// same nanosecond apart.
+func runKey(run Run) []byte {
+	return []byte(fmt.Sprintf("%020d-%s", run.StartedAt.UnixNano(), run.ID))
+}
+
+// Record stores a run, replacing an earlier record with the same ID.
+func (s *Store) Record(run Run) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return put(tx, run)
+	})
+}
+
+// RecordRollback stores a rollback run and marks the run it undid, together.
+func (s *Store) RecordRollback(rollback Run, original Run) error {
+	rollback.RollbackOf = original.ID
+	original.RolledBackBy = rollback.ID
+	return s.update(func(tx *bolt.Tx) error {
+		if err := put(tx, rollback); err != nil {
+			return err
+		}
+		return put(tx, original)
+	})
+}
+
+func put(tx *bolt.Tx, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	runs, ids := tx.Bucket(runsBucket), tx.Bucket(runIDsBucket)
+	if old := ids.Get([]byte(run.ID)); old != nil {
+		if err := runs.Delete(old); err != nil {
+			return err
+		}
+	}
+	key := runKey(run)
+	if err := runs.Put(key, data); err != nil {
+		return err
+	}
+	return ids.Put([]byte(run.ID), key)
+}
+
+// RecordRun stores the stats of a finished run. It implements
+// scheduler.Recorder.
+func (s *Store) RecordRun(stats scheduler.RunStats) error {
+	return s.Record(FromStats(stats))
+}
+
+// Run returns the run with the given ID.
+func (s *Store) Run(id string) (Run, error) {
+	var run Run
+	err := s.view(func(tx *bolt.Tx) error {
+		key := tx.Bucket(runIDsBucket).Get([]byte(id))
+		if key == nil {
+			return fmt.Errorf("%w: '%s'", ErrRunNotFound, id)
+		}
+		return json.Unmarshal(tx.Bucket(runsBucket).Get(key), &run)
+	})
+	return run, err
+}
+
+// each calls fn with every run, newest first, until fn returns false.
+func (s *Store) each(fn func(Run) bool) error {
+	return s.view(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(runsBucket).Cursor()
+		for key, data := cursor.Last(); key != nil; key, data = cursor.Prev() {
+			var run Run
+			if err := json.Unmarshal(data, &run); err != nil {
+				return fmt.Errorf("corrupt run record %s: %w", key, err)
+			}
+			if !fn(run) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// Runs returns up to limit runs, newest first. A limit of 0 returns all of
+// them.
+func (s *Store) Runs(limit int) ([]Run, error) {
+	var runs []Run
+	err := s.each(func(run Run) bool {
+		runs = append(runs, run)
+		return limit <= 0 || len(runs) < limit
+	})
+	return runs, err
+}
+
+// AnimeEntry is the outcome of an anime entry together with its run.
+type AnimeEntry struct {
+	Run     Run
+	Outcome AnimeOutcome
+}
+
+// AnimeHistory returns up to limit outcomes of the anime entries whose name
+// or Sonarr title matches one of names, ignoring case, newest first.
+func (s *Store) AnimeHistory(names []string, limit int) ([]AnimeEntry, error) {
+	matches := func(outcome AnimeOutcome) bool {
+		for _, name := range names {
+			if strings.EqualFold(outcome.Anime, name) || strings.EqualFold(outcome.SeriesTitle, name) {
+				return true
+			}
+		}
+		return false
+	}
+	var entries []AnimeEntry
+	err := s.each(func(run Run) bool {
+		for _, outcome := range run.Animes {
+			if matches(outcome) {
+				entries = append(entries, AnimeEntry{Run: run, Outcome: outcome})
+			}
+		}
+		return limit <= 0 || len(entries) < limit
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, err
+}
+
+// emailDigest is the stored queue of a batched email digest.
+type emailDigest struct {
+	Pending  []scheduler.RunStats `json:"pending"`
+	Dropped  int                  `json:"dropped,omitempty"`
+	LastSent time.Time            `json:"last_sent"`
+}
+
+// EmailDigest returns the runs queued for the next email digest, how many
+// older runs were dropped from the queue, and when the last digest was sent,
+// zero if none was. It implements notify.DigestStore.
+func (s *Store) EmailDigest() ([]scheduler.RunStats, int, time.Time, error) {
+	var digest emailDigest
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(emailDigestBucket)
+		if bucket == nil {
+			return nil
+		}
+		data := bucket.Get(emailDigestKey)
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &digest)
+	})
+	return digest.Pending, digest.Dropped, digest.LastSent, err
+}
+
+// SaveEmailDigest replaces the queue of the email digest.
+func (s *Store) SaveEmailDigest(pending []scheduler.RunStats, dropped int, lastSent time.Time) error {
+	data, err := json.Marshal(emailDigest{Pending: pending, Dropped: dropped, LastSent: lastSent})
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(emailDigestBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(emailDigestKey, data)
+	})
+}
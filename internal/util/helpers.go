@@ -1,6 +1,8 @@
 package util
 
 import (
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -75,3 +77,36 @@ func GetOrdinalSuffix(day int) string {
 		return "th"
 	}
 }
+
+// FormatEpisodeRanges compresses episode numbers into a sorted, human readable
+// list such as "1-3, 7, 10-12".
+func FormatEpisodeRanges(episodes []int) string {
+	if len(episodes) == 0 {
+		return ""
+	}
+	sorted := append([]int(nil), episodes...)
+	sort.Ints(sorted)
+
+	var parts []string
+	start, prev := sorted[0], sorted[0]
+	flush := func() {
+		if start == prev {
+			parts = append(parts, strconv.Itoa(start))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", start, prev))
+		}
+	}
+	for _, ep := range sorted[1:] {
+		if ep == prev {
+			continue
+		}
+		if ep == prev+1 {
+			prev = ep
+			continue
+		}
+		flush()
+		start, prev = ep, ep
+	}
+	flush()
+	return strings.Join(parts, ", ")
+}
@@ -1,34 +1,27 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"kotei/internal/config"
-	"kotei/internal/scheduler"
-	"kotei/internal/sonarr"
-	"kotei/internal/util"
+	"kotei/internal/logging"
+
+	"github.com/fatih/color"
 )
 
 func main() {
 	log.SetFlags(0)
-
-	appConfig, err := config.LoadConfig()
-	if err != nil {
-		return
-	}
-
-	log.Println(util.BlueBold("--- Anime Canon Episode Monitor (Kotei) ---"))
-	if appConfig.DryRun {
-		log.Println(util.YellowBold(" *** DRY RUN MODE ENABLED (via config) ***"))
-	}
-
-	appBaseLogger := log.Default()
-	sClient := sonarr.NewClient(appConfig, appBaseLogger)
-
-	errorCount := scheduler.Run(appConfig, sClient, appConfig.DryRun)
-
-	if errorCount > 0 {
-		os.Exit(1)
-	}
+	// Until the config selects a log format, color only an interactive stderr.
+	color.NoColor = !logging.ColorEnabled(os.Stderr)
+
+	// The first SIGINT/SIGTERM starts a graceful shutdown; a second one
+	// terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	code := runCLI(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
 }
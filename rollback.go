@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"kotei/internal/logging"
+	"kotei/internal/processor"
+	"kotei/internal/scheduler"
+	"kotei/internal/sonarr"
+	"kotei/internal/state"
+	"kotei/internal/util"
+)
+
+// rollbackAnime is the part of a run to undo for one anime entry: the
+// episodes whose monitored flag the run changed.
+type rollbackAnime struct {
+	outcome  state.AnimeOutcome
+	episodes []state.EpisodeChange
+}
+
+// rollbackSteps collects the monitor and unmonitor changes of run. Searches
+// cannot be undone and are left out.
+func rollbackSteps(run state.Run) []rollbackAnime {
+	var steps []rollbackAnime
+	for _, outcome := range run.Animes {
+		step := rollbackAnime{outcome: outcome}
+		for _, change := range outcome.Changes {
+			if monitored, ok := change.Monitored(); ok && monitored != change.Previous() {
+				step.episodes = append(step.episodes, change)
+			}
+		}
+		if len(step.episodes) > 0 {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// lastRollbackCandidate returns the newest run that changed monitored flags
+// and was not rolled back yet. Dry runs and rollbacks are passed over.
+func lastRollbackCandidate(store *state.Store) (state.Run, bool, error) {
+	runs, err := store.Runs(0)
+	if err != nil {
+		return state.Run{}, false, err
+	}
+	for _, run := range runs {
+		if run.DryRun || run.RolledBackBy != "" || run.Trigger == scheduler.TriggerRollback {
+			continue
+		}
+		if len(rollbackSteps(run)) > 0 {
+			return run, true, nil
+		}
+	}
+	return state.Run{}, false, nil
+}
+
+// checkDrift compares the episodes of step with Sonarr and returns those
+// whose monitored flag no longer is what the run set, described for the log.
+func checkDrift(ctx context.Context, sClient *sonarr.Client, step rollbackAnime) (map[int]string, error) {
+	episodes, err := sClient.GetSeriesEpisodes(ctx, step.outcome.SeriesID)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[int]sonarr.Episode, len(episodes))
+	for _, ep := range episodes {
+		current[ep.ID] = ep
+	}
+	drifted := map[int]string{}
+	for _, change := range step.episodes {
+		set, _ := change.Monitored()
+		ep, ok := current[change.EpisodeID]
+		switch {
+		case !ok:
+			drifted[change.EpisodeID] = "no longer in Sonarr"
+		case ep.Monitored != set:
+			drifted[change.EpisodeID] = fmt.Sprintf("is %s now, the run left it %s",
+				util.Iif(ep.Monitored, "monitored", "unmonitored"), util.Iif(set, "monitored", "unmonitored"))
+		}
+	}
+	return drifted, nil
+}
+
+func runRollbackCommand(ctx context.Context, args []string) int {
+	var common commonFlags
+	fs := newFlagSet("rollback", &common, false)
+	fs.BoolVar(&common.dryRun, "dry-run", false, "show what would be restored without changing Sonarr")
+	runID := fs.String("run", "", "roll back the run with this ID")
+	last := fs.Bool("last", false, "roll back the newest run that changed monitored flags and was not rolled back yet")
+	force := fs.Bool("force", false, "skip episodes changed in Sonarr since the run instead of refusing")
+	if err := fs.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if fs.NArg() != 0 || (*runID == "") == !*last {
+		fmt.Fprintln(os.Stderr, "Usage: kotei rollback [--config path] [--dry-run] [--force] --run <id> | --last")
+		return exitUsage
+	}
+
+	appConfig, code := loadConfig(common)
+	if code != exitOK {
+		return code
+	}
+	store, code := openStateForReading(appConfig)
+	if store == nil {
+		return code
+	}
+	logger := slog.Default()
+
+	var original state.Run
+	if *last {
+		run, found, err := lastRollbackCandidate(store)
+		if err != nil {
+			log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+			return exitRunErrors
+		}
+		if !found {
+			fmt.Println("No run left to roll back.")
+			return exitOK
+		}
+		original = run
+	} else {
+		run, err := store.Run(*runID)
+		if err != nil {
+			log.Printf("%s %v", util.RedBold("!!! ERROR"), err)
+			return exitUsage
+		}
+		original = run
+	}
+	switch {
+	case original.DryRun:
+		log.Printf("%s Run %s was a dry run and changed nothing in Sonarr.", util.RedBold("!!! ERROR"), original.ID)
+		return exitUsage
+	case original.RolledBackBy != "":
+		log.Printf("%s Run %s was already rolled back by run %s.", util.RedBold("!!! ERROR"), original.ID, original.RolledBackBy)
+		return exitUsage
+	}
+	steps := rollbackSteps(original)
+	if len(steps) == 0 {
+		fmt.Printf("Run %s changed no monitored flags, nothing to roll back.\n", original.ID)
+		return exitOK
+	}
+
+	logger.Info("Rolling back run", "run_id", original.ID, "trigger", original.Trigger,
+		"started", original.StartedAt.Local().Format(historyTimeFormat))
+	sClient := sonarr.NewClient(appConfig, logger)
+
+	// Every entry is checked before anything is restored, so a refusal
+	// leaves Sonarr untouched.
+	driftLevel := slog.LevelError
+	if *force {
+		driftLevel = slog.LevelWarn
+	}
+	driftCount, restoreCount := 0, 0
+	for i, step := range steps {
+		drifted, err := checkDrift(ctx, sClient, step)
+		if err != nil {
+			logger.Error("Could not load episodes from Sonarr", "anime", step.outcome.Anime, "error", err)
+			return exitRunErrors
+		}
+		kept := step.episodes[:0:0]
+		for _, change := range step.episodes {
+			reason, isDrifted := drifted[change.EpisodeID]
+			if !isDrifted {
+				kept = append(kept, change)
+				continue
+			}
+			driftCount++
+			logger.Log(ctx, driftLevel, fmt.Sprintf("Episode #%d S%02dE%02d changed in Sonarr since the run", change.Number, change.Season, change.Episode),
+				"anime", step.outcome.Anime, "episode_id", change.EpisodeID, "state", reason)
+		}
+		steps[i].episodes = kept
+		restoreCount += len(kept)
+	}
+	if driftCount > 0 && !*force {
+		logger.Error("Refusing to roll back: Sonarr changed since the run. Use --force to restore the other episodes.",
+			"run_id", original.ID, "drifted", driftCount)
+		return exitRunErrors
+	}
+	if restoreCount == 0 {
+		logger.Warn("Nothing left to restore, every episode changed in Sonarr since the run.", "run_id", original.ID)
+		return exitOK
+	}
+
+	stats := scheduler.RunStats{
+		ID:        scheduler.NewRunID(),
+		Trigger:   scheduler.TriggerRollback,
+		StartedAt: time.Now(),
+		DryRun:    appConfig.DryRun,
+		Animes:    []scheduler.AnimeResult{},
+	}
+	for _, step := range steps {
+		if len(step.episodes) == 0 {
+			continue
+		}
+		stats.Processed++
+		result := restoreAnime(ctx, logger, sClient, original.ID, step, appConfig.DryRun)
+		if result.Status == scheduler.AnimeStatusOK {
+			stats.OK++
+		} else {
+			stats.Errors++
+			stats.Failed++
+		}
+		stats.Animes = append(stats.Animes, result)
+	}
+	stats.FinishedAt = time.Now()
+
+	if appConfig.DryRun {
+		logging.Heading(logger, "(Dry Run - No changes made)")
+		return exitOK
+	}
+	// A rollback with failures is recorded but leaves the run open, so it
+	// can be retried with --force.
+	rollback := state.FromStats(stats)
+	var err error
+	if stats.Failed > 0 {
+		err = store.Record(rollback)
+	} else {
+		err = store.RecordRollback(rollback, original)
+	}
+	if err != nil {
+		logger.Warn("Failed to record run in the state store", "run_id", stats.ID, "error", err)
+	}
+	if stats.Failed > 0 {
+		logger.Error("Rollback completed with errors.", "run_id", stats.ID, "failed", stats.Failed)
+		return exitRunErrors
+	}
+	logger.Info("Rollback completed successfully.", "run_id", stats.ID)
+	return exitOK
+}
+
+// restoreAnime sets the monitored flags of step back to what they were
+// before the run, through Sonarr's /episode/monitor.
+func restoreAnime(ctx context.Context, logger *slog.Logger, sClient *sonarr.Client, originalID string, step rollbackAnime, dryRun bool) scheduler.AnimeResult {
+	animeLogger := logger.With("anime", step.outcome.Anime, "sonarr_series_id", step.outcome.SeriesID)
+	logging.Heading(animeLogger, "Rolling back: "+step.outcome.Anime)
+	result := scheduler.AnimeResult{
+		Anime:       step.outcome.Anime,
+		Status:      scheduler.AnimeStatusOK,
+		SeriesID:    step.outcome.SeriesID,
+		SeriesTitle: step.outcome.SeriesTitle,
+	}
+
+	var monitor, unmonitor []processor.PlannedEpisode
+	for _, change := range step.episodes {
+		set, _ := change.Monitored()
+		planned := processor.PlannedEpisode{
+			EpisodeID:     change.EpisodeID,
+			Number:        change.Number,
+			SeasonNumber:  change.Season,
+			EpisodeNumber: change.Episode,
+			Title:         change.Title,
+			Reason:        "rollback of run " + originalID,
+			WasMonitored:  set,
+		}
+		if change.Previous() {
+			monitor = append(monitor, planned)
+		} else {
+			unmonitor = append(unmonitor, planned)
+		}
+	}
+
+	for _, restore := range []struct {
+		episodes  []processor.PlannedEpisode
+		monitored bool
+	}{
+		{monitor, true},
+		{unmonitor, false},
+	} {
+		if len(restore.episodes) == 0 {
+			continue
+		}
+		numbers := make([]int, 0, len(restore.episodes))
+		ids := make([]int, 0, len(restore.episodes))
+		for _, ep := range restore.episodes {
+			numbers = append(numbers, ep.Number)
+			ids = append(ids, ep.EpisodeID)
+		}
+		animeLogger.Info(util.Iif(restore.monitored, "Monitoring again", "Unmonitoring again"),
+			"count", len(ids), "episodes", util.FormatEpisodeRanges(numbers))
+		var err error
+		if restore.monitored {
+			err = sClient.MonitorEpisodes(ctx, ids, dryRun)
+		} else {
+			err = sClient.UnmonitorEpisodes(ctx, ids, dryRun)
+		}
+		if err != nil {
+			animeLogger.Error("Sonarr monitor update failed", "error", err)
+			result.Status, result.Error = scheduler.AnimeStatusError, err.Error()
+			continue
+		}
+		result.ActionTaken = true
+		if restore.monitored {
+			result.Monitored = restore.episodes
+		} else {
+			result.Unmonitored = restore.episodes
+		}
+	}
+	result.FinishedAt = time.Now()
+	return result
+}
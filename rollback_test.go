@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"kotei/internal/processor"
+	"kotei/internal/scheduler"
+	"kotei/internal/sonarr"
+	"kotei/internal/state"
+)
+
+// fakeSonarr serves the episodes of one series and records monitor updates.
+type fakeSonarr struct {
+	mu       sync.Mutex
+	episodes []sonarr.Episode
+	updates  []sonarr.EpisodeMonitorRequest
+}
+
+func (f *fakeSonarr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v3/episode":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(f.episodes)
+	case r.Method == http.MethodPut && r.URL.Path == "/api/v3/episode/monitor":
+		var update sonarr.EpisodeMonitorRequest
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.updates = append(f.updates, update)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// setupRollback records a run that monitored episodes 101 and 102 of series
+// 7 and returns a config file pointing at sonarrURL and the state store.
+func setupRollback(t *testing.T, sonarrURL string) (string, *state.Store, state.Run) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	configYAML := fmt.Sprintf(`sonarr:
+  baseurl: %s
+  apikey: test
+  retry_count: 0
+log:
+  level: error
+state:
+  data_dir: %s
+animes:
+  - title: one-piece
+    sonarr_title: One Piece
+`, sonarrURL, dir)
+	if err := os.WriteFile(configPath, []byte(configYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := state.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := time.Now().Add(-time.Hour)
+	stats := scheduler.RunStats{
+		ID:         "run-1",
+		Trigger:    scheduler.TriggerManual,
+		StartedAt:  finished.Add(-time.Minute),
+		FinishedAt: finished,
+		Processed:  1,
+		OK:         1,
+		Animes: []scheduler.AnimeResult{{
+			Anime:       "One Piece",
+			Status:      scheduler.AnimeStatusOK,
+			ActionTaken: true,
+			FinishedAt:  finished,
+			SeriesID:    7,
+			SeriesTitle: "One Piece",
+			Monitored: []processor.PlannedEpisode{
+				{EpisodeID: 101, Number: 1, SeasonNumber: 1, EpisodeNumber: 1},
+				{EpisodeID: 102, Number: 2, SeasonNumber: 1, EpisodeNumber: 2},
+			},
+		}},
+	}
+	run := state.FromStats(stats)
+	if err := store.Record(run); err != nil {
+		t.Fatal(err)
+	}
+	return configPath, store, run
+}
+
+func TestRollbackDrift(t *testing.T) {
+	tests := []struct {
+		name         string
+		monitored102 bool // episode 102 in Sonarr now; false means it was changed since the run
+		force        bool
+		wantCode     int
+		wantUpdates  []sonarr.EpisodeMonitorRequest
+		wantRolled   bool
+	}{
+		{
+			name:         "unchanged episodes are restored",
+			monitored102: true,
+			wantCode:     exitOK,
+			wantUpdates:  []sonarr.EpisodeMonitorRequest{{EpisodeIDs: []int{101, 102}, Monitored: false}},
+			wantRolled:   true,
+		},
+		{
+			name:     "a drifted episode refuses the rollback",
+			wantCode: exitRunErrors,
+		},
+		{
+			name:        "force restores only the unchanged episode",
+			force:       true,
+			wantCode:    exitOK,
+			wantUpdates: []sonarr.EpisodeMonitorRequest{{EpisodeIDs: []int{101}, Monitored: false}},
+			wantRolled:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSonarr{episodes: []sonarr.Episode{
+				{ID: 101, AbsoluteEpisodeNumber: 1, SeasonNumber: 1, EpisodeNumber: 1, Monitored: true},
+				{ID: 102, AbsoluteEpisodeNumber: 2, SeasonNumber: 1, EpisodeNumber: 2, Monitored: tt.monitored102},
+			}}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			configPath, store, run := setupRollback(t, server.URL)
+
+			args := []string{"--config", configPath, "--run", run.ID}
+			if tt.force {
+				args = append(args, "--force")
+			}
+			if code := runRollbackCommand(context.Background(), args); code != tt.wantCode {
+				t.Fatalf("rollback exit code = %d, want %d", code, tt.wantCode)
+			}
+			if !reflect.DeepEqual(fake.updates, tt.wantUpdates) {
+				t.Errorf("monitor updates = %+v, want %+v", fake.updates, tt.wantUpdates)
+			}
+
+			recorded, err := store.Run(run.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rolled := recorded.RolledBackBy != ""; rolled != tt.wantRolled {
+				t.Errorf("run rolled back = %t, want %t", rolled, tt.wantRolled)
+			}
+		})
+	}
+}